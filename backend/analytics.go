@@ -0,0 +1,366 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// analyticsIntervals are the buckets time series can be grouped by.
+var analyticsIntervals = []string{"day", "week", "month"}
+
+// analyticsFilter holds the filters shared by the analytics endpoints. Queries take
+// the tenant scope as $1, the inclusive date range as $2 and $3 and the company as
+// $4; endpoint-specific parameters start at $5.
+type analyticsFilter struct {
+	scope     int
+	from, to  string
+	companyID int
+	interval  string
+}
+
+func (f analyticsFilter) args(extra ...interface{}) []interface{} {
+	return append([]interface{}{f.scope, f.from, f.to, f.companyID}, extra...)
+}
+
+// parseAnalyticsFilter reads from, to (YYYY-MM-DD, the last 90 days by default),
+// company_id and interval (week by default).
+func parseAnalyticsFilter(c *gin.Context) (analyticsFilter, error) {
+	today := time.Now()
+	f := analyticsFilter{
+		scope:    tenantScope(c),
+		from:     c.DefaultQuery("from", today.AddDate(0, 0, -90).Format("2006-01-02")),
+		to:       c.DefaultQuery("to", today.Format("2006-01-02")),
+		interval: c.DefaultQuery("interval", "week"),
+	}
+	if err := validateDate("from", &f.from); err != nil {
+		return f, err
+	}
+	if err := validateDate("to", &f.to); err != nil {
+		return f, err
+	}
+	if f.to < f.from {
+		return f, fmt.Errorf("to must not be before from")
+	}
+	if !contains(analyticsIntervals, f.interval) {
+		return f, fmt.Errorf("interval must be one of: day, week, month")
+	}
+	f.companyID, _ = strconv.Atoi(c.Query("company_id"))
+	return f, nil
+}
+
+// analyticsApplicationsWhere restricts applications a of internships i to those
+// submitted in the filter's range to internships in scope.
+const analyticsApplicationsWhere = `
+	WHERE ($1 = 0 OR i.organization_id = $1)
+	  AND a.applied_date >= $2::date AND a.applied_date < $3::date + 1
+	  AND ($4 = 0 OR i.company_id = $4)
+`
+
+type FunnelAnalytics struct {
+	Applications            int     `json:"applications"`
+	Pending                 int     `json:"pending"`
+	Interviewed             int     `json:"interviewed"`
+	Accepted                int     `json:"accepted"`
+	Rejected                int     `json:"rejected"`
+	AcceptedAfterInterview  int     `json:"accepted_after_interview"`
+	InterviewRate           float64 `json:"interview_rate"`
+	AcceptanceRate          float64 `json:"acceptance_rate"`
+	InterviewAcceptanceRate float64 `json:"interview_acceptance_rate"`
+}
+
+type DecisionTime struct {
+	Outcome      string  `json:"outcome"`
+	Decisions    int     `json:"decisions"`
+	AverageHours float64 `json:"average_hours"`
+	MedianHours  float64 `json:"median_hours"`
+	P90Hours     float64 `json:"p90_hours"`
+}
+
+type ApplicationSeries struct {
+	InternshipID int              `json:"internship_id"`
+	Title        string           `json:"title"`
+	Total        int              `json:"total"`
+	Points       []AnalyticsPoint `json:"points"`
+}
+
+type AnalyticsPoint struct {
+	Period string `json:"period"`
+	Count  int    `json:"count"`
+}
+
+type ActiveUsersPoint struct {
+	Period string `json:"period"`
+	Role   string `json:"role"`
+	Users  int    `json:"users"`
+}
+
+type SkillDemand struct {
+	Skill        string `json:"skill"`
+	Internships  int    `json:"internships"`
+	Applications int    `json:"applications"`
+}
+
+func ratio(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(n) / float64(total)
+}
+
+// getFunnelAnalytics counts applications by how far they got. An application counts
+// as interviewed if it was ever in the interview stage.
+func getFunnelAnalytics(c *gin.Context) {
+	f, err := parseAnalyticsFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var funnel FunnelAnalytics
+	err = db.QueryRow(`
+		WITH interviewed AS (
+			SELECT DISTINCT application_id FROM application_status_history WHERE status = 'interview'
+		)
+		SELECT COUNT(*),
+		       COUNT(*) FILTER (WHERE a.status = 'pending'),
+		       COUNT(*) FILTER (WHERE a.status = 'interview' OR iv.application_id IS NOT NULL),
+		       COUNT(*) FILTER (WHERE a.status = 'accepted'),
+		       COUNT(*) FILTER (WHERE a.status = 'rejected'),
+		       COUNT(*) FILTER (WHERE a.status = 'accepted' AND iv.application_id IS NOT NULL)
+		FROM applications a
+		JOIN internships i ON i.id = a.internship_id
+		LEFT JOIN interviewed iv ON iv.application_id = a.id
+	`+analyticsApplicationsWhere, f.args()...).Scan(
+		&funnel.Applications, &funnel.Pending, &funnel.Interviewed, &funnel.Accepted, &funnel.Rejected,
+		&funnel.AcceptedAfterInterview,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	funnel.InterviewRate = ratio(funnel.Interviewed, funnel.Applications)
+	funnel.AcceptanceRate = ratio(funnel.Accepted, funnel.Applications)
+	funnel.InterviewAcceptanceRate = ratio(funnel.AcceptedAfterInterview, funnel.Interviewed)
+
+	c.JSON(http.StatusOK, funnel)
+}
+
+// getDecisionTimeAnalytics measures the hours from application to the first
+// acceptance or rejection, per outcome and overall ("all"). Decisions recorded before
+// status changes were timestamped are left out.
+func getDecisionTimeAnalytics(c *gin.Context) {
+	f, err := parseAnalyticsFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rows, err := db.Query(`
+		WITH decisions AS (
+			SELECT DISTINCT ON (a.id) h.status,
+			       EXTRACT(EPOCH FROM (h.changed_at - a.applied_date)) / 3600 AS hours
+			FROM applications a
+			JOIN internships i ON i.id = a.internship_id
+			JOIN application_status_history h ON h.application_id = a.id
+			     AND h.status IN ('accepted', 'rejected') AND h.changed_at IS NOT NULL
+	`+analyticsApplicationsWhere+`
+			ORDER BY a.id, h.changed_at
+		)
+		SELECT COALESCE(status, 'all'), COUNT(*), COALESCE(AVG(hours), 0),
+		       COALESCE(percentile_cont(0.5) WITHIN GROUP (ORDER BY hours), 0),
+		       COALESCE(percentile_cont(0.9) WITHIN GROUP (ORDER BY hours), 0)
+		FROM decisions
+		GROUP BY ROLLUP (status)
+		ORDER BY status NULLS FIRST
+	`, f.args()...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	times := []DecisionTime{}
+	for rows.Next() {
+		var t DecisionTime
+		if err := rows.Scan(&t.Outcome, &t.Decisions, &t.AverageHours, &t.MedianHours, &t.P90Hours); err != nil {
+			continue
+		}
+		times = append(times, t)
+	}
+
+	c.JSON(http.StatusOK, times)
+}
+
+// getApplicationsAnalytics counts applications per internship and interval. Periods
+// without applications are omitted.
+func getApplicationsAnalytics(c *gin.Context) {
+	f, err := parseAnalyticsFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	internshipID, _ := strconv.Atoi(c.Query("internship_id"))
+
+	rows, err := db.Query(`
+		SELECT i.id, i.title, to_char(date_trunc($5, a.applied_date), 'YYYY-MM-DD'), COUNT(*)
+		FROM applications a
+		JOIN internships i ON i.id = a.internship_id
+	`+analyticsApplicationsWhere+`
+		  AND ($6 = 0 OR i.id = $6)
+		GROUP BY i.id, i.title, 3
+		ORDER BY i.id, 3
+	`, f.args(f.interval, internshipID)...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	series := []ApplicationSeries{}
+	for rows.Next() {
+		var id, count int
+		var title, period string
+		if err := rows.Scan(&id, &title, &period, &count); err != nil {
+			continue
+		}
+		if len(series) == 0 || series[len(series)-1].InternshipID != id {
+			series = append(series, ApplicationSeries{InternshipID: id, Title: title, Points: []AnalyticsPoint{}})
+		}
+		s := &series[len(series)-1]
+		s.Points = append(s.Points, AnalyticsPoint{Period: period, Count: count})
+		s.Total += count
+	}
+
+	c.JSON(http.StatusOK, series)
+}
+
+// getActiveUsersAnalytics counts the users who used the API, by role, over the whole
+// range and per interval.
+func getActiveUsersAnalytics(c *gin.Context) {
+	f, err := parseAnalyticsFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	const activity = `
+		FROM user_activity ua
+		JOIN users u ON u.id = ua.user_id
+		WHERE ($1 = 0 OR u.organization_id = $1)
+		  AND ua.day BETWEEN $2::date AND $3::date
+		  AND ($4 = 0 OR u.company_id = $4)
+	`
+	rows, err := db.Query("SELECT u.role, COUNT(DISTINCT ua.user_id)"+activity+"GROUP BY u.role", f.args()...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	totals := map[string]int{}
+	for rows.Next() {
+		var role string
+		var users int
+		if err := rows.Scan(&role, &users); err != nil {
+			continue
+		}
+		totals[role] = users
+	}
+	rows.Close()
+
+	rows, err = db.Query(`
+		SELECT to_char(date_trunc($5, ua.day), 'YYYY-MM-DD'), u.role, COUNT(DISTINCT ua.user_id)
+	`+activity+`
+		GROUP BY 1, 2
+		ORDER BY 1, 2
+	`, f.args(f.interval)...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	series := []ActiveUsersPoint{}
+	for rows.Next() {
+		var p ActiveUsersPoint
+		if err := rows.Scan(&p.Period, &p.Role, &p.Users); err != nil {
+			continue
+		}
+		series = append(series, p)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"totals": totals, "series": series})
+}
+
+// getSkillsAnalytics ranks the skills internships posted in the range require, by
+// the number of internships and the applications they received.
+func getSkillsAnalytics(c *gin.Context) {
+	f, err := parseAnalyticsFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	limit := 20
+	if l, err := strconv.Atoi(c.Query("limit")); err == nil && l > 0 && l <= 100 {
+		limit = l
+	}
+
+	rows, err := db.Query(`
+		WITH skills AS (
+			SELECT i.id, lower(trim(skill)) AS skill,
+			       (SELECT COUNT(*) FROM applications a WHERE a.internship_id = i.id) AS applications
+			FROM internships i
+			CROSS JOIN LATERAL unnest(COALESCE(i.requirements, '{}')) AS skill
+			WHERE ($1 = 0 OR i.organization_id = $1)
+			  AND i.posted_date >= $2::date AND i.posted_date < $3::date + 1
+			  AND ($4 = 0 OR i.company_id = $4)
+		)
+		SELECT skill, COUNT(DISTINCT id), SUM(applications)
+		FROM skills
+		WHERE skill <> ''
+		GROUP BY skill
+		ORDER BY 2 DESC, 3 DESC, skill
+		LIMIT $5
+	`, f.args(limit)...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	skills := []SkillDemand{}
+	for rows.Next() {
+		var s SkillDemand
+		if err := rows.Scan(&s.Skill, &s.Internships, &s.Applications); err != nil {
+			continue
+		}
+		skills = append(skills, s)
+	}
+
+	c.JSON(http.StatusOK, skills)
+}
+
+// activityRecorded remembers the day each user's activity was last recorded, so
+// authenticated requests only write to user_activity once per user and day.
+var activityRecorded sync.Map
+
+// recordActivity marks the user as active today for the active users analytics.
+func recordActivity(userID int) {
+	today := time.Now().Format("2006-01-02")
+	if day, ok := activityRecorded.Load(userID); ok && day == today {
+		return
+	}
+	_, err := db.Exec(
+		"INSERT INTO user_activity (user_id, day) VALUES ($1, $2) ON CONFLICT DO NOTHING",
+		userID, today,
+	)
+	if err != nil {
+		log.Printf("Error recording activity of user %d: %v", userID, err)
+		return
+	}
+	activityRecorded.Store(userID, today)
+}
@@ -0,0 +1,510 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Every create, update and delete route is wrapped in audit, which appends an entry
+// to audit_log after the handler succeeds and before the response is sent: who did
+// it from where, what they did, and the entity's row before and after as JSON with
+// the changed fields. The table is
+// append-only; a trigger rejects updates and deletes, and it has no foreign keys so
+// entries outlive the users and entities they mention. Because entries are kept
+// forever, they hold no personal data: personal columns are redacted and actors'
+// emails are looked up when entries are read, so anonymizing a user also
+// anonymizes the log.
+
+// auditTables maps entity types, the prefix of an action, to the table their
+// snapshots are read from. Entities without a table are logged without snapshots.
+var auditTables = map[string]string{
+	"application":         "applications",
+	"availability_rule":   "availability_rules",
+	"company":             "companies",
+	"conversation":        "conversations",
+	"evaluation":          "evaluations",
+	"evaluation_template": "evaluation_templates",
+	"goal":                "goals",
+	"internship":          "internships",
+	"internship_template": "internship_templates",
+	"invitation":          "invitations",
+	"meeting":             "meetings",
+	"mentorship":          "mentorships",
+	"message":             "messages",
+	"milestone":           "milestones",
+	"notification":        "notifications",
+	"organization":        "organizations",
+	"report_definition":   "report_definitions",
+	"report_schedule":     "report_schedules",
+	"saved_search":        "saved_searches",
+	"timesheet":           "timesheets",
+	"user":                "users",
+	"webhook":             "webhook_subscriptions",
+	"webhook_delivery":    "webhook_deliveries",
+}
+
+// auditRedacted are columns whose values never reach the audit log. Changes to
+// them are still recorded, with both values redacted.
+var auditRedacted = map[string]bool{
+	"password_hash":  true,
+	"calendar_token": true,
+	"secret":         true,
+	"token":          true,
+	"token_hash":     true,
+}
+
+// auditPersonal are the columns, by table, holding personal data. Like redacted
+// columns, changes to them are recorded without their values.
+var auditPersonal = map[string]map[string]bool{
+	"users": {
+		"email": true, "name": true, "avatar": true, "department": true, "company": true, "bio": true,
+		"skills": true, "experience": true, "suspension_reason": true,
+	},
+	"applications":     {"student_name": true, "cover_letter": true, "resume": true},
+	"internships":      {"mentor_name": true},
+	"invitations":      {"email": true},
+	"messages":         {"body": true},
+	"mentorships":      {"message": true, "end_reason": true},
+	"meetings":         {"notes": true, "cancel_reason": true},
+	"timesheets":       {"accomplishments": true, "blockers": true, "next_week_plan": true, "review_comment": true},
+	"milestones":       {"intern_note": true, "evidence_links": true},
+	"evaluations":      {"answers": true},
+	"report_schedules": {"recipients": true},
+}
+
+const auditRedactedValue = "[redacted]"
+
+// auditHidden reports whether the column's values are kept out of the audit log.
+func auditHidden(table, column string) bool {
+	return auditRedacted[column] || auditPersonal[table][column]
+}
+
+// auditEntityIDKey lets handlers name the entity they changed when it is neither in
+// the route nor the response.
+const auditEntityIDKey = "audit_entity_id"
+
+type AuditEntry struct {
+	ID         int     `json:"id" db:"id"`
+	ActorID    *int    `json:"actor_id" db:"actor_id"`
+	ActorEmail *string `json:"actor_email" db:"actor_email"`
+	ActorRole  *string `json:"actor_role" db:"actor_role"`
+	// ImpersonatorID is the admin who acted as the actor
+	ImpersonatorID    *int            `json:"impersonator_id" db:"impersonator_id"`
+	ImpersonatorEmail *string         `json:"impersonator_email" db:"impersonator_email"`
+	OrganizationID    *int            `json:"organization_id" db:"organization_id"`
+	Action            string          `json:"action" db:"action"`
+	EntityType        string          `json:"entity_type" db:"entity_type"`
+	EntityID          *int            `json:"entity_id" db:"entity_id"`
+	Method            string          `json:"method" db:"method"`
+	Path              string          `json:"path" db:"path"`
+	Status            int             `json:"status" db:"status"`
+	Before            json.RawMessage `json:"before" db:"before"`
+	After             json.RawMessage `json:"after" db:"after"`
+	Changes           json.RawMessage `json:"changes" db:"changes"`
+	IPAddress         string          `json:"ip_address" db:"ip_address"`
+	UserAgent         string          `json:"user_agent" db:"user_agent"`
+	CreatedAt         time.Time       `json:"created_at" db:"created_at"`
+}
+
+type auditChange struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+// auditResponseWriter holds back the response until the audit entry is recorded,
+// and lets the ID of a created entity be read from it.
+type auditResponseWriter struct {
+	gin.ResponseWriter
+	status  int
+	written bool
+	body    bytes.Buffer
+}
+
+func (w *auditResponseWriter) WriteHeader(code int) {
+	if code > 0 && !w.written {
+		w.status = code
+	}
+}
+
+func (w *auditResponseWriter) WriteHeaderNow() {
+	w.written = true
+}
+
+func (w *auditResponseWriter) Write(b []byte) (int, error) {
+	w.written = true
+	return w.body.Write(b)
+}
+
+func (w *auditResponseWriter) WriteString(s string) (int, error) {
+	w.written = true
+	return w.body.WriteString(s)
+}
+
+func (w *auditResponseWriter) Status() int   { return w.status }
+func (w *auditResponseWriter) Size() int     { return w.body.Len() }
+func (w *auditResponseWriter) Written() bool { return w.written }
+func (w *auditResponseWriter) Flush()        {}
+
+// send writes the held back response to the client.
+func (w *auditResponseWriter) send() {
+	w.ResponseWriter.WriteHeader(w.status)
+	if w.body.Len() == 0 {
+		w.ResponseWriter.WriteHeaderNow()
+		return
+	}
+	if _, err := w.ResponseWriter.Write(w.body.Bytes()); err != nil {
+		log.Printf("Error writing response: %v", err)
+	}
+}
+
+// audit records the action after the handler succeeds. param names the route
+// parameter holding the entity's ID; when empty, as for creates, the ID is read
+// from the "id" or "user_id" field of the response. The handler has committed by
+// then, so an entry that cannot be recorded is logged and the response kept.
+func audit(action, param string) gin.HandlerFunc {
+	entityType := strings.SplitN(action, ".", 2)[0]
+	table := auditTables[entityType]
+
+	return func(c *gin.Context) {
+		var entityID int
+		if param != "" {
+			entityID, _ = strconv.Atoi(c.Param(param))
+		}
+
+		var before map[string]interface{}
+		if table != "" && entityID != 0 {
+			before = auditSnapshot(db, table, entityID)
+		}
+		w := &auditResponseWriter{ResponseWriter: c.Writer, status: http.StatusOK}
+		c.Writer = w
+		defer func() {
+			// Let the recovery middleware answer on the real writer
+			if p := recover(); p != nil {
+				c.Writer = w.ResponseWriter
+				panic(p)
+			}
+		}()
+
+		c.Next()
+
+		c.Writer = w.ResponseWriter
+		if w.status >= http.StatusBadRequest || c.IsAborted() {
+			w.send()
+			return
+		}
+		if id := c.GetInt(auditEntityIDKey); id != 0 {
+			entityID = id
+		} else if param == "" {
+			entityID = responseID(w.body.Bytes())
+		}
+		var after map[string]interface{}
+		if table != "" && entityID != 0 {
+			after = auditSnapshot(db, table, entityID)
+		}
+
+		entry := newAuditEntry(c, action, entityType)
+		entry.Status = w.status
+		if entityID != 0 {
+			entry.EntityID = &entityID
+		}
+		if entry.OrganizationID == nil {
+			entry.OrganizationID = snapshotOrganization(after, before)
+		}
+		entry.Before, entry.After, entry.Changes = auditDiff(table, before, after)
+
+		if err := recordAudit(db, entry); err != nil {
+			log.Printf("Error recording audit entry for %s: %v", action, err)
+		}
+		w.send()
+	}
+}
+
+// newAuditEntry describes the request and who made it. With an impersonation token
+// the actor is the impersonated user and the impersonator the admin behind it.
+func newAuditEntry(c *gin.Context, action, entityType string) AuditEntry {
+	entry := AuditEntry{
+		Action:     action,
+		EntityType: entityType,
+		Method:     c.Request.Method,
+		Path:       c.Request.URL.Path,
+		Status:     c.Writer.Status(),
+		IPAddress:  c.ClientIP(),
+		UserAgent:  c.Request.UserAgent(),
+	}
+	if id := currentUserID(c); id != 0 {
+		entry.ActorID = &id
+		role := currentUserRole(c)
+		entry.ActorRole = &role
+	}
+	if id := impersonatorID(c); id != 0 {
+		entry.ImpersonatorID = &id
+	}
+	if id := currentOrganizationID(c); id != 0 {
+		entry.OrganizationID = &id
+	}
+	return entry
+}
+
+// auditSnapshot reads the entity's row as a JSON object, or nil when it does not
+// exist.
+func auditSnapshot(q sqlQueryer, table string, id int) map[string]interface{} {
+	var data []byte
+	if err := q.QueryRow("SELECT row_to_json(t) FROM "+table+" t WHERE t.id = $1", id).Scan(&data); err != nil {
+		return nil
+	}
+	var row map[string]interface{}
+	if err := json.Unmarshal(data, &row); err != nil {
+		return nil
+	}
+	return row
+}
+
+func responseID(body []byte) int {
+	var response struct {
+		ID     int `json:"id"`
+		UserID int `json:"user_id"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return 0
+	}
+	if response.ID != 0 {
+		return response.ID
+	}
+	return response.UserID
+}
+
+func snapshotOrganization(rows ...map[string]interface{}) *int {
+	for _, row := range rows {
+		if id, ok := row["organization_id"].(float64); ok {
+			organizationID := int(id)
+			return &organizationID
+		}
+	}
+	return nil
+}
+
+// auditDiff redacts the snapshots of a table's row and lists the fields that differ
+// between them. Changes are only recorded for updates, when both snapshots exist.
+func auditDiff(table string, before, after map[string]interface{}) (json.RawMessage, json.RawMessage, json.RawMessage) {
+	var changes map[string]auditChange
+	if before != nil && after != nil {
+		changes = map[string]auditChange{}
+		for key, from := range before {
+			if to := after[key]; !reflect.DeepEqual(from, to) {
+				changes[key] = auditChange{From: from, To: to}
+			}
+		}
+		for key, to := range after {
+			if _, ok := before[key]; !ok {
+				changes[key] = auditChange{To: to}
+			}
+		}
+		for key := range changes {
+			if auditHidden(table, key) {
+				changes[key] = auditChange{From: auditRedactedValue, To: auditRedactedValue}
+			}
+		}
+	}
+	return auditJSON(redactSnapshot(table, before)), auditJSON(redactSnapshot(table, after)), auditJSON(changes)
+}
+
+func redactSnapshot(table string, row map[string]interface{}) map[string]interface{} {
+	if row == nil {
+		return nil
+	}
+	for key := range row {
+		if auditHidden(table, key) {
+			row[key] = auditRedactedValue
+		}
+	}
+	return row
+}
+
+// auditJSON encodes v, or returns nil for a nil map so the column stays NULL.
+func auditJSON(v interface{}) json.RawMessage {
+	if reflect.ValueOf(v).IsNil() {
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+func recordAudit(ex sqlExecer, e AuditEntry) error {
+	_, err := ex.Exec(`
+		INSERT INTO audit_log (actor_id, actor_role, impersonator_id, organization_id,
+		                       action, entity_type, entity_id, method, path, status, before, after, changes, ip_address, user_agent)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+	`, e.ActorID, e.ActorRole, e.ImpersonatorID, e.OrganizationID, e.Action, e.EntityType, e.EntityID,
+		e.Method, e.Path, e.Status, nullJSON(e.Before), nullJSON(e.After), nullJSON(e.Changes), e.IPAddress, e.UserAgent)
+	return err
+}
+
+// nullJSON passes an empty document to the database as NULL.
+func nullJSON(data json.RawMessage) interface{} {
+	if data == nil {
+		return nil
+	}
+	return string(data)
+}
+
+// auditSelect reads entries with the current emails of their actors, which are
+// replaced when a user is anonymized.
+const auditSelect = `
+	SELECT id, actor_id, (SELECT email FROM users WHERE users.id = audit_log.actor_id), actor_role,
+	       impersonator_id, (SELECT email FROM users WHERE users.id = audit_log.impersonator_id), organization_id,
+	       action, entity_type, entity_id, method, path, status, before, after, changes, ip_address, user_agent, created_at
+	FROM audit_log
+`
+
+// auditWhere filters entries by tenant ($1), actor ($2), action ($3), entity type
+// ($4), entity ID ($5), the from ($6) and to ($7) dates, inclusive, and
+// impersonator ($8).
+const auditWhere = `
+	WHERE ($1 = 0 OR organization_id = $1)
+	  AND ($2 = 0 OR actor_id = $2)
+	  AND ($8 = 0 OR impersonator_id = $8)
+	  AND ($3 = '' OR action = $3)
+	  AND ($4 = '' OR entity_type = $4)
+	  AND ($5 = 0 OR entity_id = $5)
+	  AND created_at >= COALESCE(NULLIF($6, '')::date, '-infinity')
+	  AND created_at < COALESCE(NULLIF($7, '')::date + 1, 'infinity')
+`
+
+func scanAuditEntry(row interface{ Scan(...interface{}) error }) (AuditEntry, error) {
+	var e AuditEntry
+	var before, after, changes []byte
+	err := row.Scan(&e.ID, &e.ActorID, &e.ActorEmail, &e.ActorRole, &e.ImpersonatorID, &e.ImpersonatorEmail, &e.OrganizationID, &e.Action, &e.EntityType,
+		&e.EntityID, &e.Method, &e.Path, &e.Status, &before, &after, &changes, &e.IPAddress, &e.UserAgent, &e.CreatedAt)
+	e.Before, e.After, e.Changes = before, after, changes
+	return e, err
+}
+
+// auditFilterArgs reads the filters of auditWhere from the query string.
+func auditFilterArgs(c *gin.Context) ([]interface{}, error) {
+	from, to := c.Query("from"), c.Query("to")
+	if from != "" {
+		if err := validateDate("from", &from); err != nil {
+			return nil, err
+		}
+	}
+	if to != "" {
+		if err := validateDate("to", &to); err != nil {
+			return nil, err
+		}
+	}
+	actorID, _ := strconv.Atoi(c.Query("actor_id"))
+	entityID, _ := strconv.Atoi(c.Query("entity_id"))
+	impersonatorID, _ := strconv.Atoi(c.Query("impersonator_id"))
+	return []interface{}{
+		tenantScope(c), actorID, c.Query("action"), c.Query("entity_type"), entityID, from, to, impersonatorID,
+	}, nil
+}
+
+// getAuditLog lists entries newest first, with limit (default 100, at most 500)
+// and offset for paging.
+func getAuditLog(c *gin.Context) {
+	args, err := auditFilterArgs(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	limit := 100
+	if l, err := strconv.Atoi(c.Query("limit")); err == nil && l > 0 && l <= 500 {
+		limit = l
+	}
+	offset, _ := strconv.Atoi(c.Query("offset"))
+	if offset < 0 {
+		offset = 0
+	}
+
+	rows, err := db.Query(auditSelect+auditWhere+"ORDER BY id DESC LIMIT $9 OFFSET $10", append(args, limit, offset)...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	entries := []AuditEntry{}
+	for rows.Next() {
+		e, err := scanAuditEntry(rows)
+		if err != nil {
+			continue
+		}
+		entries = append(entries, e)
+	}
+
+	c.JSON(http.StatusOK, entries)
+}
+
+// exportAuditLog streams all entries matching the filters as CSV, oldest first.
+func exportAuditLog(c *gin.Context) {
+	args, err := auditFilterArgs(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rows, err := db.Query(auditSelect+auditWhere+"ORDER BY id", args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="audit-log-%s.csv"`, time.Now().Format("2006-01-02")))
+	c.Status(http.StatusOK)
+
+	w := csv.NewWriter(c.Writer)
+	w.Write([]string{
+		"id", "created_at", "actor_id", "actor_email", "actor_role", "impersonator_id", "impersonator_email",
+		"organization_id", "action", "entity_type",
+		"entity_id", "method", "path", "status", "ip_address", "user_agent", "before", "after", "changes",
+	})
+	for rows.Next() {
+		e, err := scanAuditEntry(rows)
+		if err != nil {
+			log.Printf("Error exporting audit log: %v", err)
+			break
+		}
+		w.Write([]string{
+			strconv.Itoa(e.ID), e.CreatedAt.Format(time.RFC3339), optionalInt(e.ActorID),
+			spreadsheetText(optionalString(e.ActorEmail)), spreadsheetText(optionalString(e.ActorRole)),
+			optionalInt(e.ImpersonatorID), spreadsheetText(optionalString(e.ImpersonatorEmail)),
+			optionalInt(e.OrganizationID), spreadsheetText(e.Action), spreadsheetText(e.EntityType), optionalInt(e.EntityID),
+			e.Method, spreadsheetText(e.Path), strconv.Itoa(e.Status), spreadsheetText(e.IPAddress), spreadsheetText(e.UserAgent),
+			string(e.Before), string(e.After), string(e.Changes),
+		})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		log.Printf("Error exporting audit log: %v", err)
+	}
+}
+
+func optionalInt(v *int) string {
+	if v == nil {
+		return ""
+	}
+	return strconv.Itoa(*v)
+}
+
+func optionalString(v *string) string {
+	if v == nil {
+		return ""
+	}
+	return *v
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxSavedSearchAlertTitles caps the internship titles listed in one alert.
+const maxSavedSearchAlertTitles = 5
+
+type SavedSearch struct {
+	ID            int              `json:"id" db:"id"`
+	Name          string           `json:"name" db:"name"`
+	Filters       InternshipFilter `json:"filters" db:"filters"`
+	AlertsEnabled bool             `json:"alerts_enabled" db:"alerts_enabled"`
+	LastAlertedAt *time.Time       `json:"last_alerted_at" db:"last_alerted_at"`
+	CreatedAt     time.Time        `json:"created_at" db:"created_at"`
+}
+
+type SavedSearchRequest struct {
+	Name          string           `json:"name" binding:"required"`
+	Filters       InternshipFilter `json:"filters"`
+	AlertsEnabled *bool            `json:"alerts_enabled"`
+}
+
+const savedSearchSelect = `
+	SELECT id, name, filters, alerts_enabled, last_alerted_at, created_at FROM saved_searches
+`
+
+func scanSavedSearch(row interface{ Scan(...interface{}) error }) (SavedSearch, error) {
+	var s SavedSearch
+	var filters []byte
+	if err := row.Scan(&s.ID, &s.Name, &filters, &s.AlertsEnabled, &s.LastAlertedAt, &s.CreatedAt); err != nil {
+		return s, err
+	}
+	err := json.Unmarshal(filters, &s.Filters)
+	return s, err
+}
+
+func getBookmarks(c *gin.Context) {
+	internships, err := searchInternships(db, InternshipFilter{}, tenantScope(c), currentUserID(c), `
+		AND EXISTS (SELECT 1 FROM bookmarks b WHERE b.internship_id = i.id AND b.user_id = $28)
+	`, currentUserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, internships)
+}
+
+func addBookmark(c *gin.Context) {
+	internshipID, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+	found, err := internshipInScope(db, tenantScope(c), internshipID)
+	if !requireInScope(c, found, err, "Internship not found") {
+		return
+	}
+
+	_, err = db.Exec(
+		"INSERT INTO bookmarks (user_id, internship_id) VALUES ($1, $2) ON CONFLICT DO NOTHING",
+		currentUserID(c), internshipID,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Internship bookmarked"})
+}
+
+func removeBookmark(c *gin.Context) {
+	internshipID, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+
+	_, err := db.Exec("DELETE FROM bookmarks WHERE user_id = $1 AND internship_id = $2", currentUserID(c), internshipID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Bookmark removed"})
+}
+
+func getSavedSearches(c *gin.Context) {
+	rows, err := db.Query(savedSearchSelect+" WHERE user_id = $1 ORDER BY created_at DESC", currentUserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	searches := []SavedSearch{}
+	for rows.Next() {
+		s, err := scanSavedSearch(rows)
+		if err != nil {
+			continue
+		}
+		searches = append(searches, s)
+	}
+
+	c.JSON(http.StatusOK, searches)
+}
+
+// createSavedSearch stores the filters. Alerts only cover internships published
+// after the search was saved.
+func createSavedSearch(c *gin.Context) {
+	var req SavedSearchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := req.Filters.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := req.Filters.locate(geocoder); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	filters, err := json.Marshal(req.Filters)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var id int
+	err = db.QueryRow(`
+		INSERT INTO saved_searches (user_id, name, filters, alerts_enabled)
+		VALUES ($1, $2, $3, $4) RETURNING id
+	`, currentUserID(c), req.Name, filters, req.AlertsEnabled == nil || *req.AlertsEnabled).Scan(&id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"id": id, "message": "Search saved successfully"})
+}
+
+func updateSavedSearch(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+	var req SavedSearchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := req.Filters.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := req.Filters.locate(geocoder); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	filters, err := json.Marshal(req.Filters)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := db.Exec(`
+		UPDATE saved_searches SET name = $1, filters = $2, alerts_enabled = COALESCE($3, alerts_enabled)
+		WHERE id = $4 AND user_id = $5
+	`, req.Name, filters, req.AlertsEnabled, id, currentUserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Saved search not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Saved search updated successfully"})
+}
+
+func deleteSavedSearch(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+
+	result, err := db.Exec("DELETE FROM saved_searches WHERE id = $1 AND user_id = $2", id, currentUserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Saved search not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Saved search deleted successfully"})
+}
+
+// getSavedSearchResults runs a saved search.
+func getSavedSearchResults(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+
+	s, err := scanSavedSearch(db.QueryRow(savedSearchSelect+" WHERE id = $1 AND user_id = $2", id, currentUserID(c)))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Saved search not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	internships, err := searchInternships(db, s.Filters, tenantScope(c), currentUserID(c), "")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, internships)
+}
+
+// sendSavedSearchAlerts matches internships published since each saved search was
+// last checked and notifies its owner about active matches. Each search remembers
+// the time it was checked up to, so every posting is considered once, including
+// drafts published later.
+func sendSavedSearchAlerts() (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var now time.Time
+	if err := tx.QueryRow("SELECT CURRENT_TIMESTAMP::timestamp").Scan(&now); err != nil {
+		return 0, err
+	}
+
+	type pendingSearch struct {
+		search         SavedSearch
+		userID         int
+		organizationID int
+		checkedUntil   time.Time
+	}
+	rows, err := tx.Query(`
+		SELECT s.id, s.name, s.filters, s.alerts_enabled, s.last_alerted_at, s.created_at,
+		       s.user_id, COALESCE(u.organization_id, -1), s.checked_until
+		FROM saved_searches s
+		JOIN users u ON u.id = s.user_id
+		WHERE s.alerts_enabled
+		  AND EXISTS (SELECT 1 FROM internships i WHERE i.published_at > s.checked_until AND i.published_at <= $1)
+		FOR UPDATE OF s SKIP LOCKED
+	`, now)
+	if err != nil {
+		return 0, err
+	}
+	var pending []pendingSearch
+	for rows.Next() {
+		var p pendingSearch
+		var filters []byte
+		err := rows.Scan(&p.search.ID, &p.search.Name, &filters, &p.search.AlertsEnabled, &p.search.LastAlertedAt,
+			&p.search.CreatedAt, &p.userID, &p.organizationID, &p.checkedUntil)
+		if err != nil || json.Unmarshal(filters, &p.search.Filters) != nil {
+			continue
+		}
+		pending = append(pending, p)
+	}
+	rows.Close()
+
+	alerted := 0
+	for _, p := range pending {
+		// Alerts are about open postings, whatever status the search filters on
+		filter := p.search.Filters
+		filter.Status = "active"
+		matches, err := searchInternships(tx, filter, p.organizationID, 0, " AND i.published_at > $28 AND i.published_at <= $29", p.checkedUntil, now)
+		if err != nil {
+			return 0, err
+		}
+
+		if len(matches) > 0 {
+			titles := []string{}
+			for i, internship := range matches {
+				if i == maxSavedSearchAlertTitles {
+					break
+				}
+				titles = append(titles, internship.Title)
+			}
+			err := dispatchEvent(tx, DomainEvent{
+				Type:       EventSavedSearchMatched,
+				Recipients: []int{p.userID},
+				Data: map[string]interface{}{
+					"saved_search_id":   p.search.ID,
+					"saved_search_name": p.search.Name,
+					"count":             len(matches),
+					"internship_titles": titles,
+					"internship_id":     matches[0].ID,
+				},
+			})
+			if err != nil {
+				return 0, err
+			}
+			alerted++
+		}
+
+		_, err = tx.Exec(`
+			UPDATE saved_searches SET checked_until = $1,
+			       last_alerted_at = CASE WHEN $2 THEN CURRENT_TIMESTAMP ELSE last_alerted_at END
+			WHERE id = $3
+		`, now, len(matches) > 0, p.search.ID)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return alerted, tx.Commit()
+}
@@ -0,0 +1,815 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+	// Availability rules use IANA time zones; embed the database so they load on
+	// images without zoneinfo
+	_ "time/tzdata"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxSlotRange bounds how many days of slots can be computed in one request.
+const maxSlotRange = 31 * 24 * time.Hour
+
+type AvailabilityRule struct {
+	ID          int       `json:"id" db:"id"`
+	MentorID    int       `json:"mentor_id" db:"mentor_id"`
+	Weekday     int       `json:"weekday" db:"weekday"`
+	StartTime   string    `json:"start_time" db:"start_time"`
+	EndTime     string    `json:"end_time" db:"end_time"`
+	Timezone    string    `json:"timezone" db:"timezone"`
+	SlotMinutes int       `json:"slot_minutes" db:"slot_minutes"`
+	ValidFrom   *string   `json:"valid_from" db:"valid_from"`
+	ValidUntil  *string   `json:"valid_until" db:"valid_until"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+}
+
+type AvailabilityRuleRequest struct {
+	Weekday     int     `json:"weekday" binding:"min=0,max=6"`
+	StartTime   string  `json:"start_time" binding:"required"`
+	EndTime     string  `json:"end_time" binding:"required"`
+	Timezone    string  `json:"timezone" binding:"required"`
+	SlotMinutes int     `json:"slot_minutes"`
+	ValidFrom   *string `json:"valid_from"`
+	ValidUntil  *string `json:"valid_until"`
+}
+
+type Slot struct {
+	StartsAt time.Time `json:"starts_at"`
+	EndsAt   time.Time `json:"ends_at"`
+	Timezone string    `json:"timezone"`
+}
+
+type Meeting struct {
+	ID           int        `json:"id" db:"id"`
+	MentorID     int        `json:"mentor_id" db:"mentor_id"`
+	MentorName   string     `json:"mentor_name"`
+	StudentID    int        `json:"student_id" db:"student_id"`
+	StudentName  string     `json:"student_name"`
+	StartsAt     time.Time  `json:"starts_at" db:"starts_at"`
+	EndsAt       time.Time  `json:"ends_at" db:"ends_at"`
+	Title        string     `json:"title" db:"title"`
+	Notes        *string    `json:"notes" db:"notes"`
+	Location     *string    `json:"location" db:"location"`
+	Status       string     `json:"status" db:"status"`
+	CancelReason *string    `json:"cancel_reason" db:"cancel_reason"`
+	CreatedAt    time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt    *time.Time `json:"updated_at" db:"updated_at"`
+}
+
+type BookMeetingRequest struct {
+	MentorID int       `json:"mentor_id" binding:"required"`
+	StartsAt time.Time `json:"starts_at" binding:"required"`
+	Title    string    `json:"title"`
+	Notes    *string   `json:"notes"`
+	Location *string   `json:"location"`
+}
+
+type RescheduleMeetingRequest struct {
+	StartsAt time.Time `json:"starts_at" binding:"required"`
+}
+
+type CancelMeetingRequest struct {
+	Reason *string `json:"reason"`
+}
+
+// sqlQueryer is satisfied by both *sql.DB and *sql.Tx.
+type sqlQueryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+const meetingSelect = `
+	SELECT m.id, m.mentor_id, mu.name, m.student_id, su.name, m.starts_at, m.ends_at, m.title, m.notes,
+	       m.location, m.status, m.cancel_reason, m.created_at, m.updated_at
+	FROM meetings m
+	JOIN users mu ON mu.id = m.mentor_id
+	JOIN users su ON su.id = m.student_id
+`
+
+func scanMeeting(row interface{ Scan(...interface{}) error }) (Meeting, error) {
+	var m Meeting
+	err := row.Scan(&m.ID, &m.MentorID, &m.MentorName, &m.StudentID, &m.StudentName, &m.StartsAt, &m.EndsAt,
+		&m.Title, &m.Notes, &m.Location, &m.Status, &m.CancelReason, &m.CreatedAt, &m.UpdatedAt)
+	return m, err
+}
+
+func validateAvailabilityRule(req *AvailabilityRuleRequest) error {
+	if _, err := time.LoadLocation(req.Timezone); err != nil {
+		return fmt.Errorf("unknown timezone %q", req.Timezone)
+	}
+	start, err := time.Parse("15:04", req.StartTime)
+	if err != nil {
+		return fmt.Errorf("start_time must be HH:MM")
+	}
+	end, err := time.Parse("15:04", req.EndTime)
+	if err != nil {
+		return fmt.Errorf("end_time must be HH:MM")
+	}
+	if !end.After(start) {
+		return fmt.Errorf("end_time must be after start_time")
+	}
+	if req.SlotMinutes == 0 {
+		req.SlotMinutes = 30
+	}
+	if req.SlotMinutes < 10 || req.SlotMinutes > 240 {
+		return fmt.Errorf("slot_minutes must be between 10 and 240")
+	}
+	for _, date := range []*string{req.ValidFrom, req.ValidUntil} {
+		if date != nil {
+			if _, err := time.Parse("2006-01-02", *date); err != nil {
+				return fmt.Errorf("dates must be YYYY-MM-DD")
+			}
+		}
+	}
+	return nil
+}
+
+func loadAvailabilityRules(q sqlQueryer, mentorID int) ([]AvailabilityRule, error) {
+	rows, err := q.Query(`
+		SELECT id, mentor_id, weekday, to_char(start_time, 'HH24:MI'), to_char(end_time, 'HH24:MI'), timezone,
+		       slot_minutes, to_char(valid_from, 'YYYY-MM-DD'), to_char(valid_until, 'YYYY-MM-DD'), created_at
+		FROM availability_rules WHERE mentor_id = $1 ORDER BY weekday, start_time
+	`, mentorID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rules := []AvailabilityRule{}
+	for rows.Next() {
+		var r AvailabilityRule
+		err := rows.Scan(&r.ID, &r.MentorID, &r.Weekday, &r.StartTime, &r.EndTime, &r.Timezone,
+			&r.SlotMinutes, &r.ValidFrom, &r.ValidUntil, &r.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, r)
+	}
+	return rules, rows.Err()
+}
+
+// expandRule generates the rule's slots that start within [from, to). Days are walked
+// in the rule's own time zone so slots follow its daylight saving transitions.
+func expandRule(rule AvailabilityRule, from, to time.Time) []Slot {
+	loc, err := time.LoadLocation(rule.Timezone)
+	if err != nil {
+		return nil
+	}
+	start, _ := time.Parse("15:04", rule.StartTime)
+	end, _ := time.Parse("15:04", rule.EndTime)
+	step := time.Duration(rule.SlotMinutes) * time.Minute
+
+	var slots []Slot
+	first := from.In(loc).AddDate(0, 0, -1)
+	day := time.Date(first.Year(), first.Month(), first.Day(), 0, 0, 0, 0, loc)
+	for ; day.Before(to); day = day.AddDate(0, 0, 1) {
+		if int(day.Weekday()) != rule.Weekday {
+			continue
+		}
+		date := day.Format("2006-01-02")
+		if (rule.ValidFrom != nil && date < *rule.ValidFrom) || (rule.ValidUntil != nil && date > *rule.ValidUntil) {
+			continue
+		}
+
+		windowEnd := time.Date(day.Year(), day.Month(), day.Day(), end.Hour(), end.Minute(), 0, 0, loc)
+		slotStart := time.Date(day.Year(), day.Month(), day.Day(), start.Hour(), start.Minute(), 0, 0, loc)
+		for ; !slotStart.Add(step).After(windowEnd); slotStart = slotStart.Add(step) {
+			if slotStart.Before(from) || !slotStart.Before(to) {
+				continue
+			}
+			slots = append(slots, Slot{StartsAt: slotStart.UTC(), EndsAt: slotStart.Add(step).UTC(), Timezone: rule.Timezone})
+		}
+	}
+	return slots
+}
+
+// availableSlots returns the mentor's bookable slots in [from, to): the slots of all
+// availability rules, minus past slots and those overlapping scheduled meetings.
+// excludeMeetingID ignores one meeting, so it can be moved to an overlapping slot.
+func availableSlots(q sqlQueryer, mentorID int, from, to time.Time, excludeMeetingID int) ([]Slot, error) {
+	rules, err := loadAvailabilityRules(q, mentorID)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := q.Query(`
+		SELECT starts_at, ends_at FROM meetings
+		WHERE mentor_id = $1 AND status = 'scheduled' AND id <> $2 AND starts_at < $3 AND ends_at > $4
+	`, mentorID, excludeMeetingID, to, from)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var booked []Slot
+	for rows.Next() {
+		var b Slot
+		if err := rows.Scan(&b.StartsAt, &b.EndsAt); err != nil {
+			return nil, err
+		}
+		booked = append(booked, b)
+	}
+
+	now := time.Now()
+	seen := map[time.Time]bool{}
+	slots := []Slot{}
+	for _, rule := range rules {
+		for _, slot := range expandRule(rule, from, to) {
+			if slot.StartsAt.Before(now) || seen[slot.StartsAt] {
+				continue
+			}
+			free := true
+			for _, b := range booked {
+				if slot.StartsAt.Before(b.EndsAt) && slot.EndsAt.After(b.StartsAt) {
+					free = false
+					break
+				}
+			}
+			if free {
+				seen[slot.StartsAt] = true
+				slots = append(slots, slot)
+			}
+		}
+	}
+
+	sort.Slice(slots, func(i, j int) bool { return slots[i].StartsAt.Before(slots[j].StartsAt) })
+	return slots, nil
+}
+
+// findSlot returns the available slot starting exactly at startsAt.
+func findSlot(q sqlQueryer, mentorID int, startsAt time.Time, excludeMeetingID int) (Slot, bool, error) {
+	slots, err := availableSlots(q, mentorID, startsAt, startsAt.Add(time.Minute), excludeMeetingID)
+	if err != nil {
+		return Slot{}, false, err
+	}
+	for _, slot := range slots {
+		if slot.StartsAt.Equal(startsAt) {
+			return slot, true, nil
+		}
+	}
+	return Slot{}, false, nil
+}
+
+func getAvailabilityRules(c *gin.Context) {
+	rules, err := loadAvailabilityRules(db, currentUserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, rules)
+}
+
+func getMentorAvailability(c *gin.Context) {
+	mentorID, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+	found, err := userInScope(db, tenantScope(c), mentorID)
+	if !requireInScope(c, found, err, "Mentor not found") {
+		return
+	}
+	rules, err := loadAvailabilityRules(db, mentorID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, rules)
+}
+
+func createAvailabilityRule(c *gin.Context) {
+	var req AvailabilityRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateAvailabilityRule(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var id int
+	err := db.QueryRow(`
+		INSERT INTO availability_rules (mentor_id, weekday, start_time, end_time, timezone, slot_minutes, valid_from, valid_until)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id
+	`, currentUserID(c), req.Weekday, req.StartTime, req.EndTime, req.Timezone, req.SlotMinutes, req.ValidFrom, req.ValidUntil).Scan(&id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"id": id, "message": "Availability created successfully"})
+}
+
+func updateAvailabilityRule(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+	var req AvailabilityRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateAvailabilityRule(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := db.Exec(`
+		UPDATE availability_rules
+		SET weekday = $1, start_time = $2, end_time = $3, timezone = $4, slot_minutes = $5, valid_from = $6, valid_until = $7
+		WHERE id = $8 AND mentor_id = $9
+	`, req.Weekday, req.StartTime, req.EndTime, req.Timezone, req.SlotMinutes, req.ValidFrom, req.ValidUntil, id, currentUserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Availability not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Availability updated successfully"})
+}
+
+func deleteAvailabilityRule(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+	if _, err := db.Exec("DELETE FROM availability_rules WHERE id = $1 AND mentor_id = $2", id, currentUserID(c)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Availability deleted successfully"})
+}
+
+// getMentorSlots lists bookable slots between the "from" and "to" dates (inclusive,
+// YYYY-MM-DD, UTC). It defaults to the next 14 days.
+func getMentorSlots(c *gin.Context) {
+	mentorID, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+	found, err := userInScope(db, tenantScope(c), mentorID)
+	if !requireInScope(c, found, err, "Mentor not found") {
+		return
+	}
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	from, to := today, today.AddDate(0, 0, 14)
+	if v := c.Query("from"); v != "" {
+		t, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from must be YYYY-MM-DD"})
+			return
+		}
+		from = t
+	}
+	if v := c.Query("to"); v != "" {
+		t, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "to must be YYYY-MM-DD"})
+			return
+		}
+		to = t.AddDate(0, 0, 1)
+	}
+	if !to.After(from) || to.Sub(from) > maxSlotRange {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Date range must be between 1 and 31 days"})
+		return
+	}
+
+	slots, err := availableSlots(db, mentorID, from, to, 0)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, slots)
+}
+
+// getMeetings lists the caller's meetings ending after "from" and starting before
+// "to", given as YYYY-MM-DD (UTC, inclusive) or RFC 3339 times. It defaults to
+// meetings from the last 30 days on.
+func getMeetings(c *gin.Context) {
+	userID := currentUserID(c)
+	from := time.Now().UTC().AddDate(0, 0, -30)
+	var to *time.Time
+	if v := c.Query("from"); v != "" {
+		t, ok := parseMeetingTime(v, false)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from must be YYYY-MM-DD or an RFC 3339 time"})
+			return
+		}
+		from = t
+	}
+	if v := c.Query("to"); v != "" {
+		t, ok := parseMeetingTime(v, true)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "to must be YYYY-MM-DD or an RFC 3339 time"})
+			return
+		}
+		to = &t
+	}
+
+	rows, err := db.Query(meetingSelect+`
+		WHERE (m.mentor_id = $1 OR m.student_id = $1)
+		  AND ($2 = '' OR m.status = $2)
+		  AND m.ends_at >= $3
+		  AND ($4::timestamptz IS NULL OR m.starts_at < $4)
+		ORDER BY m.starts_at
+	`, userID, c.Query("status"), from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	meetings := []Meeting{}
+	for rows.Next() {
+		m, err := scanMeeting(rows)
+		if err != nil {
+			continue
+		}
+		meetings = append(meetings, m)
+	}
+
+	c.JSON(http.StatusOK, meetings)
+}
+
+// parseMeetingTime reads a date or an RFC 3339 time. A date used as the end of a
+// range covers the whole day.
+func parseMeetingTime(v string, end bool) (time.Time, bool) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t.UTC(), true
+	}
+	t, err := time.Parse("2006-01-02", v)
+	if err != nil {
+		return time.Time{}, false
+	}
+	if end {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, true
+}
+
+func bookMeeting(c *gin.Context) {
+	var req BookMeetingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	userID := currentUserID(c)
+	if req.MentorID == userID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot book a meeting with yourself"})
+		return
+	}
+	if req.Title == "" {
+		req.Title = "Mentoring session"
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	// Serialize bookings per mentor so two students cannot take the same slot
+	var mentorName string
+	err = tx.QueryRow(
+		`SELECT name FROM users
+		 WHERE id = $1 AND role = 'mentor' AND deleted_at IS NULL AND suspended_at IS NULL AND ($2 = 0 OR organization_id = $2)
+		 FOR UPDATE`,
+		req.MentorID, tenantScope(c),
+	).Scan(&mentorName)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Mentor not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	slot, found, err := findSlot(tx, req.MentorID, req.StartsAt, 0)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusConflict, gin.H{"error": "Slot is not available"})
+		return
+	}
+
+	var id int
+	err = tx.QueryRow(`
+		INSERT INTO meetings (mentor_id, student_id, starts_at, ends_at, title, notes, location)
+		VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id
+	`, req.MentorID, userID, slot.StartsAt, slot.EndsAt, req.Title, req.Notes, req.Location).Scan(&id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var studentName string
+	tx.QueryRow("SELECT name FROM users WHERE id = $1", userID).Scan(&studentName)
+	data := map[string]interface{}{
+		"meeting_id":   id,
+		"title":        req.Title,
+		"student_name": studentName,
+		"mentor_name":  mentorName,
+		"starts_at":    slot.StartsAt.Format(time.RFC1123),
+	}
+	err = dispatchEvent(tx, DomainEvent{Type: EventMeetingBooked, ActorID: userID, Recipients: []int{req.MentorID}, Data: data})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	publishRealtime(EventMeetingBooked, []int{req.MentorID}, data)
+
+	c.JSON(http.StatusCreated, gin.H{"id": id, "starts_at": slot.StartsAt, "ends_at": slot.EndsAt, "message": "Meeting booked successfully"})
+}
+
+// loadMeetingForUpdate locks a scheduled meeting the user takes part in.
+func loadMeetingForUpdate(c *gin.Context, tx *sql.Tx, id int) (Meeting, bool) {
+	m, err := scanMeeting(tx.QueryRow(meetingSelect+" WHERE m.id = $1 FOR UPDATE OF m", id))
+	userID := currentUserID(c)
+	if err == sql.ErrNoRows || (err == nil && m.MentorID != userID && m.StudentID != userID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Meeting not found"})
+		return m, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return m, false
+	}
+	if m.Status != "scheduled" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Meeting is not scheduled"})
+		return m, false
+	}
+	return m, true
+}
+
+func otherParticipant(m Meeting, userID int) int {
+	if userID == m.MentorID {
+		return m.StudentID
+	}
+	return m.MentorID
+}
+
+func cancelMeeting(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+	var req CancelMeetingRequest
+	c.ShouldBindJSON(&req)
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	m, ok := loadMeetingForUpdate(c, tx, id)
+	if !ok {
+		return
+	}
+
+	userID := currentUserID(c)
+	_, err = tx.Exec(`
+		UPDATE meetings SET status = 'cancelled', cancelled_by = $1, cancel_reason = $2, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $3
+	`, userID, req.Reason, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	recipient := otherParticipant(m, userID)
+	data := map[string]interface{}{"meeting_id": id, "title": m.Title, "starts_at": m.StartsAt.Format(time.RFC1123)}
+	if err := dispatchEvent(tx, DomainEvent{Type: EventMeetingCancelled, ActorID: userID, Recipients: []int{recipient}, Data: data}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	publishRealtime(EventMeetingCancelled, []int{recipient}, data)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Meeting cancelled successfully"})
+}
+
+func rescheduleMeeting(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+	var req RescheduleMeetingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	m, ok := loadMeetingForUpdate(c, tx, id)
+	if !ok {
+		return
+	}
+	if _, err := tx.Exec("SELECT id FROM users WHERE id = $1 FOR UPDATE", m.MentorID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	slot, found, err := findSlot(tx, m.MentorID, req.StartsAt, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusConflict, gin.H{"error": "Slot is not available"})
+		return
+	}
+
+	_, err = tx.Exec(
+		"UPDATE meetings SET starts_at = $1, ends_at = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $3",
+		slot.StartsAt, slot.EndsAt, id,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := currentUserID(c)
+	recipient := otherParticipant(m, userID)
+	data := map[string]interface{}{
+		"meeting_id":         id,
+		"title":              m.Title,
+		"previous_starts_at": m.StartsAt.Format(time.RFC1123),
+		"starts_at":          slot.StartsAt.Format(time.RFC1123),
+	}
+	if err := dispatchEvent(tx, DomainEvent{Type: EventMeetingRescheduled, ActorID: userID, Recipients: []int{recipient}, Data: data}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	publishRealtime(EventMeetingRescheduled, []int{recipient}, data)
+
+	c.JSON(http.StatusOK, gin.H{"starts_at": slot.StartsAt, "ends_at": slot.EndsAt, "message": "Meeting rescheduled successfully"})
+}
+
+// getCalendarFeedURL returns the caller's private iCalendar feed URL, creating the
+// feed token on first use.
+func getCalendarFeedURL(c *gin.Context) {
+	token, err := calendarToken(currentUserID(c), false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"url": calendarFeedURL(c, token)})
+}
+
+// resetCalendarFeedURL rotates the feed token, invalidating previously shared URLs.
+func resetCalendarFeedURL(c *gin.Context) {
+	token, err := calendarToken(currentUserID(c), true)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Set(auditEntityIDKey, currentUserID(c))
+	c.JSON(http.StatusOK, gin.H{"url": calendarFeedURL(c, token)})
+}
+
+func calendarToken(userID int, rotate bool) (string, error) {
+	var token sql.NullString
+	if !rotate {
+		if err := db.QueryRow("SELECT calendar_token FROM users WHERE id = $1", userID).Scan(&token); err != nil {
+			return "", err
+		}
+		if token.Valid {
+			return token.String, nil
+		}
+	}
+
+	newToken, err := generateSecret()
+	if err != nil {
+		return "", err
+	}
+	_, err = db.Exec("UPDATE users SET calendar_token = $1 WHERE id = $2", newToken, userID)
+	return newToken, err
+}
+
+func calendarFeedURL(c *gin.Context, token string) string {
+	scheme := "http"
+	if c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s/api/calendar/%s.ics", scheme, c.Request.Host, token)
+}
+
+// calendarFeed serves the user's meetings as iCalendar. Calendar clients cannot send
+// a JWT, so the unguessable token in the URL authenticates the request.
+func calendarFeed(c *gin.Context) {
+	token := strings.TrimSuffix(c.Param("token"), ".ics")
+
+	var userID int
+	err := db.QueryRow(
+		"SELECT id FROM users WHERE calendar_token = $1 AND deleted_at IS NULL AND suspended_at IS NULL", token,
+	).Scan(&userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Calendar not found"})
+		return
+	}
+
+	rows, err := db.Query(meetingSelect+`
+		WHERE (m.mentor_id = $1 OR m.student_id = $1) AND m.starts_at >= CURRENT_TIMESTAMP - INTERVAL '90 days'
+		ORDER BY m.starts_at
+	`, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	var b strings.Builder
+	b.WriteString("BEGIN:VCALENDAR\r\n")
+	b.WriteString("VERSION:2.0\r\n")
+	b.WriteString("PRODID:-//LMS Internship Portal//Meetings//EN\r\n")
+	b.WriteString("CALSCALE:GREGORIAN\r\n")
+	b.WriteString("METHOD:PUBLISH\r\n")
+	b.WriteString("X-WR-CALNAME:LMS Meetings\r\n")
+
+	for rows.Next() {
+		m, err := scanMeeting(rows)
+		if err != nil {
+			continue
+		}
+		with := m.MentorName
+		if userID == m.MentorID {
+			with = m.StudentName
+		}
+		stamp := m.CreatedAt
+		if m.UpdatedAt != nil {
+			stamp = *m.UpdatedAt
+		}
+
+		b.WriteString("BEGIN:VEVENT\r\n")
+		fmt.Fprintf(&b, "UID:meeting-%d@lms\r\n", m.ID)
+		fmt.Fprintf(&b, "DTSTAMP:%s\r\n", icalTime(stamp))
+		fmt.Fprintf(&b, "DTSTART:%s\r\n", icalTime(m.StartsAt))
+		fmt.Fprintf(&b, "DTEND:%s\r\n", icalTime(m.EndsAt))
+		fmt.Fprintf(&b, "SUMMARY:%s\r\n", icalEscape(m.Title+" with "+with))
+		if m.Notes != nil {
+			fmt.Fprintf(&b, "DESCRIPTION:%s\r\n", icalEscape(*m.Notes))
+		}
+		if m.Location != nil {
+			fmt.Fprintf(&b, "LOCATION:%s\r\n", icalEscape(*m.Location))
+		}
+		if m.Status == "cancelled" {
+			b.WriteString("STATUS:CANCELLED\r\n")
+		} else {
+			b.WriteString("STATUS:CONFIRMED\r\n")
+		}
+		b.WriteString("END:VEVENT\r\n")
+	}
+	b.WriteString("END:VCALENDAR\r\n")
+
+	c.Data(http.StatusOK, "text/calendar; charset=utf-8", []byte(b.String()))
+}
+
+func icalTime(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
+
+func icalEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(s)
+}
@@ -0,0 +1,509 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+)
+
+var companyVerificationStatuses = []string{"unverified", "pending", "verified", "rejected"}
+
+// companyLegalSuffixes are dropped when comparing names, so "Tech Solutions Inc."
+// and "Tech Solutions" are the same company.
+var companyLegalSuffixes = map[string]bool{
+	"inc": true, "incorporated": true, "llc": true, "ltd": true, "limited": true, "corp": true,
+	"corporation": true, "co": true, "company": true, "gmbh": true, "plc": true, "ag": true, "sa": true,
+}
+
+type Company struct {
+	ID                 int        `json:"id" db:"id"`
+	Name               string     `json:"name" db:"name"`
+	Slug               string     `json:"slug" db:"slug"`
+	Description        *string    `json:"description" db:"description"`
+	Logo               *string    `json:"logo" db:"logo"`
+	Website            *string    `json:"website" db:"website"`
+	Industry           *string    `json:"industry" db:"industry"`
+	Location           *string    `json:"location" db:"location"`
+	VerificationStatus string     `json:"verification_status" db:"verification_status"`
+	VerificationNote   *string    `json:"verification_note" db:"verification_note"`
+	VerifiedAt         *time.Time `json:"verified_at" db:"verified_at"`
+	OpenInternships    int        `json:"open_internships"`
+	CreatedAt          time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt          *time.Time `json:"updated_at" db:"updated_at"`
+}
+
+type CompanyRequest struct {
+	Name        string  `json:"name" binding:"required"`
+	Description *string `json:"description"`
+	Logo        *string `json:"logo"`
+	Website     *string `json:"website"`
+	Industry    *string `json:"industry"`
+	Location    *string `json:"location"`
+}
+
+type CompanyVerificationRequest struct {
+	Status string  `json:"status" binding:"required"`
+	Note   *string `json:"note"`
+}
+
+const companySelect = `
+	SELECT c.id, c.name, c.slug, c.description, c.logo, c.website, c.industry, c.location,
+	       c.verification_status, c.verification_note, c.verified_at,
+	       (SELECT COUNT(*) FROM internships i WHERE i.company_id = c.id AND i.status = 'active'),
+	       c.created_at, c.updated_at
+	FROM companies c
+`
+
+func scanCompany(row interface{ Scan(...interface{}) error }) (Company, error) {
+	var co Company
+	err := row.Scan(&co.ID, &co.Name, &co.Slug, &co.Description, &co.Logo, &co.Website, &co.Industry, &co.Location,
+		&co.VerificationStatus, &co.VerificationNote, &co.VerifiedAt, &co.OpenInternships, &co.CreatedAt, &co.UpdatedAt)
+	return co, err
+}
+
+// normalizeCompanyName reduces a name to lowercase words without punctuation or a
+// trailing legal form. Companies are unique by this key.
+func normalizeCompanyName(name string) string {
+	words := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	trimmed := words
+	for len(trimmed) > 1 && companyLegalSuffixes[trimmed[len(trimmed)-1]] {
+		trimmed = trimmed[:len(trimmed)-1]
+	}
+	return strings.Join(trimmed, " ")
+}
+
+// resolveCompany finds the company matching name, creating it if needed, and returns
+// its ID and canonical name. Blank names resolve to no company.
+func resolveCompany(q sqlQueryer, name string) (*int, string, error) {
+	name = strings.TrimSpace(name)
+	key := normalizeCompanyName(name)
+	if key == "" {
+		return nil, name, nil
+	}
+
+	var id int
+	var canonical string
+	err := q.QueryRow(`
+		INSERT INTO companies (name, slug, normalized_name) VALUES ($1, $2, $3)
+		ON CONFLICT (normalized_name) DO UPDATE SET normalized_name = EXCLUDED.normalized_name
+		RETURNING id, name
+	`, name, strings.ReplaceAll(key, " ", "-"), key).Scan(&id, &canonical)
+	if err != nil {
+		return nil, "", err
+	}
+	return &id, canonical, nil
+}
+
+// errCompanyNotAllowed is returned when the caller names a company they may not
+// post for.
+var errCompanyNotAllowed = errors.New("not allowed to post for this company")
+
+// linkCompany resolves the company the caller gives a posting, by ID or by free-text
+// name. Picking an existing company by ID, or naming a verified one, requires the
+// caller to work for it or be an admin; other names link or create an unverified
+// company. The posting's current company, if any, stays allowed.
+func linkCompany(c *gin.Context, q sqlQueryer, companyID *int, name string, current *int) (*int, string, error) {
+	if companyID != nil {
+		if err := q.QueryRow("SELECT name FROM companies WHERE id = $1", *companyID).Scan(&name); err != nil {
+			return nil, "", err
+		}
+		if current != nil && *current == *companyID {
+			return companyID, name, nil
+		}
+		if err := requireCompanyUse(c, *companyID); err != nil {
+			return nil, "", err
+		}
+		return companyID, name, nil
+	}
+
+	id, canonical, err := resolveCompany(q, name)
+	if err != nil || id == nil || (current != nil && *current == *id) {
+		return id, canonical, err
+	}
+	var status string
+	if err := q.QueryRow("SELECT verification_status FROM companies WHERE id = $1", *id).Scan(&status); err != nil {
+		return nil, "", err
+	}
+	if status == "verified" {
+		if err := requireCompanyUse(c, *id); err != nil {
+			return nil, "", err
+		}
+	}
+	return id, canonical, nil
+}
+
+// requireCompanyUse returns errCompanyNotAllowed unless the caller is an admin or
+// works for the company.
+func requireCompanyUse(c *gin.Context, companyID int) error {
+	if currentUserRole(c) == "admin" {
+		return nil
+	}
+	var member bool
+	err := db.QueryRow(
+		"SELECT EXISTS (SELECT 1 FROM users WHERE id = $1 AND company_id = $2)", currentUserID(c), companyID,
+	).Scan(&member)
+	if err != nil {
+		return err
+	}
+	if !member {
+		return errCompanyNotAllowed
+	}
+	return nil
+}
+
+// linkInternshipCompany sets the internship's company for the caller with
+// linkCompany. current is the company the internship already has.
+func linkInternshipCompany(c *gin.Context, q sqlQueryer, internship *Internship, current *int) error {
+	id, name, err := linkCompany(c, q, internship.CompanyID, internship.Company, current)
+	if err != nil {
+		return err
+	}
+	internship.CompanyID, internship.Company = id, name
+	return nil
+}
+
+// companyError writes the response for an error from linkCompany.
+func companyError(c *gin.Context, err error) {
+	switch err {
+	case sql.ErrNoRows:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Company not found"})
+	case errCompanyNotAllowed:
+		c.JSON(http.StatusForbidden, gin.H{"error": "Not allowed to post for this company"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// migrateCompanies links users and internships that only have a free-text company to
+// a company row. The most frequent spelling of each company becomes its name, and the
+// text columns are rewritten to it.
+func migrateCompanies() error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`
+		SELECT company FROM (
+			SELECT company FROM users WHERE company_id IS NULL AND TRIM(company) <> ''
+			UNION ALL
+			SELECT company FROM internships WHERE company_id IS NULL AND TRIM(company) <> ''
+		) names
+		GROUP BY company
+		ORDER BY COUNT(*) DESC, company
+	`)
+	if err != nil {
+		return err
+	}
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return err
+		}
+		names = append(names, name)
+	}
+	rows.Close()
+
+	for _, name := range names {
+		id, canonical, err := resolveCompany(tx, name)
+		if err != nil {
+			return err
+		}
+		if id == nil {
+			continue
+		}
+		if _, err := tx.Exec("UPDATE users SET company_id = $1, company = $2 WHERE company_id IS NULL AND company = $3", *id, canonical, name); err != nil {
+			return err
+		}
+		if _, err := tx.Exec("UPDATE internships SET company_id = $1, company = $2 WHERE company_id IS NULL AND company = $3", *id, canonical, name); err != nil {
+			return err
+		}
+	}
+
+	if len(names) > 0 {
+		log.Printf("Linked %d company names to company profiles", len(names))
+	}
+	return tx.Commit()
+}
+
+func validateCompanyRequest(req *CompanyRequest) error {
+	req.Name = strings.TrimSpace(req.Name)
+	if normalizeCompanyName(req.Name) == "" {
+		return fmt.Errorf("name must contain letters or digits")
+	}
+	for field, value := range map[string]*string{"website": req.Website, "logo": req.Logo} {
+		if value == nil || *value == "" {
+			continue
+		}
+		u, err := url.Parse(*value)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("%s must be an absolute http(s) URL", field)
+		}
+	}
+	return nil
+}
+
+// canManageCompany reports whether the caller is an admin or a mentor working for
+// the company.
+func canManageCompany(c *gin.Context, companyID int) (bool, error) {
+	if currentUserRole(c) == "admin" {
+		return true, nil
+	}
+	var member bool
+	err := db.QueryRow(
+		"SELECT EXISTS (SELECT 1 FROM users WHERE id = $1 AND role = 'mentor' AND company_id = $2)",
+		currentUserID(c), companyID,
+	).Scan(&member)
+	return member, err
+}
+
+func getCompanies(c *gin.Context) {
+	rows, err := db.Query(companySelect+`
+		WHERE ($1 = '' OR c.name ILIKE '%' || $1 || '%' OR c.industry ILIKE '%' || $1 || '%')
+		  AND ($2 <> 'true' OR c.verification_status = 'verified')
+		  AND ($3 = '' OR c.verification_status = $3)
+		ORDER BY c.name
+	`, c.Query("q"), c.Query("verified"), c.Query("status"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	companies := []Company{}
+	for rows.Next() {
+		co, err := scanCompany(rows)
+		if err != nil {
+			continue
+		}
+		companies = append(companies, co)
+	}
+
+	c.JSON(http.StatusOK, companies)
+}
+
+// getCompany returns a company page: the profile and its open internships. The
+// company can be addressed by ID or slug.
+func getCompany(c *gin.Context) {
+	ref := c.Param("id")
+	condition := " WHERE c.slug = $1"
+	if _, err := strconv.Atoi(ref); err == nil {
+		condition = " WHERE c.id::text = $1"
+	}
+
+	co, err := scanCompany(db.QueryRow(companySelect+condition, ref))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Company not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	rows, err := db.Query(internshipSelect+`
+		WHERE i.company_id = $1 AND i.status = 'active' AND ($2 = 0 OR i.organization_id = $2)
+		GROUP BY i.id
+		ORDER BY i.posted_date DESC
+	`, co.ID, tenantScope(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	internships := []Internship{}
+	for rows.Next() {
+		internship, err := scanInternship(rows)
+		if err != nil {
+			continue
+		}
+		internships = append(internships, internship)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"company": co, "internships": internships})
+}
+
+func createCompany(c *gin.Context) {
+	var req CompanyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateCompanyRequest(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	key := normalizeCompanyName(req.Name)
+	var existingID int
+	err := db.QueryRow("SELECT id FROM companies WHERE normalized_name = $1", key).Scan(&existingID)
+	if err == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Company already exists", "id": existingID})
+		return
+	}
+	if err != sql.ErrNoRows {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var id int
+	err = db.QueryRow(`
+		INSERT INTO companies (name, slug, normalized_name, description, logo, website, industry, location)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id
+	`, req.Name, strings.ReplaceAll(key, " ", "-"), key, req.Description, req.Logo, req.Website, req.Industry, req.Location).Scan(&id)
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Company already exists"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"id": id, "message": "Company created successfully"})
+}
+
+// updateCompany edits the profile. Renaming also rewrites the company name stored on
+// the company's internships and users, and sends a verified company back to review.
+func updateCompany(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+	var req CompanyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateCompanyRequest(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	allowed, err := canManageCompany(c, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	key := normalizeCompanyName(req.Name)
+	result, err := tx.Exec(`
+		UPDATE companies SET name = $1, slug = $2, normalized_name = $3, description = $4, logo = $5,
+		       website = $6, industry = $7, location = $8, updated_at = CURRENT_TIMESTAMP,
+		       verification_status = CASE WHEN name <> $1 AND verification_status = 'verified'
+		                                  THEN 'pending' ELSE verification_status END
+		WHERE id = $9
+	`, req.Name, strings.ReplaceAll(key, " ", "-"), key, req.Description, req.Logo, req.Website, req.Industry, req.Location, id)
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Another company already uses this name"})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Company not found"})
+		return
+	}
+
+	if _, err := tx.Exec("UPDATE internships SET company = $1 WHERE company_id = $2", req.Name, id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if _, err := tx.Exec("UPDATE users SET company = $1 WHERE company_id = $2", req.Name, id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Company updated successfully"})
+}
+
+// requestCompanyVerification lets a company's mentor ask an admin to verify it.
+func requestCompanyVerification(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+	allowed, err := canManageCompany(c, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+		return
+	}
+
+	result, err := db.Exec(`
+		UPDATE companies SET verification_status = 'pending', verification_note = NULL, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND verification_status IN ('unverified', 'rejected')
+	`, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Company is already verified or awaiting review"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Verification requested"})
+}
+
+// setCompanyVerification records an admin's verification decision.
+func setCompanyVerification(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+	var req CompanyVerificationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !contains(companyVerificationStatuses, req.Status) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be one of: " + strings.Join(companyVerificationStatuses, ", ")})
+		return
+	}
+
+	result, err := db.Exec(`
+		UPDATE companies SET verification_status = $1, verification_note = $2,
+		       verified_at = CASE WHEN $1 = 'verified' THEN CURRENT_TIMESTAMP END,
+		       verified_by = CASE WHEN $1 = 'verified' THEN $3::int END,
+		       updated_at = CURRENT_TIMESTAMP
+		WHERE id = $4
+	`, req.Status, req.Note, currentUserID(c), id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Company not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Company verification updated"})
+}
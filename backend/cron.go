@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CronSchedule is a parsed five-field cron expression (minute, hour, day of month,
+// month, day of week). Fields accept *, numbers, ranges (1-5), lists (1,15) and steps
+// (*/15, 9-17/2); day of week is 0-7 with both 0 and 7 for Sunday. As in cron, when
+// both day fields are restricted a day matching either one is due.
+type CronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	domAny, dowAny                bool
+}
+
+var cronMacros = map[string]string{
+	"@hourly":  "0 * * * *",
+	"@daily":   "0 0 * * *",
+	"@weekly":  "0 0 * * 0",
+	"@monthly": "0 0 1 * *",
+	"@yearly":  "0 0 1 1 *",
+}
+
+func parseCron(expr string) (CronSchedule, error) {
+	expr = strings.TrimSpace(expr)
+	if macro, ok := cronMacros[expr]; ok {
+		expr = macro
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return CronSchedule{}, fmt.Errorf("cron expression must have 5 fields: minute hour day month weekday")
+	}
+
+	var s CronSchedule
+	var err error
+	bounds := []struct {
+		name     string
+		min, max int
+		bits     *uint64
+	}{
+		{"minute", 0, 59, &s.minute},
+		{"hour", 0, 23, &s.hour},
+		{"day of month", 1, 31, &s.dom},
+		{"month", 1, 12, &s.month},
+		{"day of week", 0, 7, &s.dow},
+	}
+	for i, b := range bounds {
+		if *b.bits, err = parseCronField(fields[i], b.min, b.max); err != nil {
+			return CronSchedule{}, fmt.Errorf("invalid %s field %q: %v", b.name, fields[i], err)
+		}
+	}
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	s.domAny, s.dowAny = fields[2] == "*", fields[4] == "*"
+	return s, nil
+}
+
+// parseCronField returns the values of a field as a bit set.
+func parseCronField(field string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("invalid step")
+			}
+			rangePart, step = part[:i], n
+		}
+
+		lo, hi := min, max
+		if rangePart != "*" {
+			bounds := strings.SplitN(rangePart, "-", 2)
+			var err error
+			if lo, err = strconv.Atoi(bounds[0]); err != nil {
+				return 0, fmt.Errorf("invalid value")
+			}
+			hi = lo
+			if len(bounds) == 2 {
+				if hi, err = strconv.Atoi(bounds[1]); err != nil {
+					return 0, fmt.Errorf("invalid value")
+				}
+			} else if step > 1 {
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("values must be between %d and %d", min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func (s CronSchedule) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	switch {
+	case s.domAny && s.dowAny:
+		return true
+	case s.domAny:
+		return dow
+	case s.dowAny:
+		return dom
+	}
+	return dom || dow
+}
+
+// Next returns the first time after t the schedule is due, in t's location. It
+// returns the zero time for schedules that never match, such as February 30th.
+// Times are matched on the wall clock: a time skipped when clocks go forward runs
+// as if they had not moved, and a time repeated when they go back runs once.
+func (s CronSchedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+	for i := 0; i < 5*366; i++ {
+		date := day.AddDate(0, 0, i)
+		if s.month&(1<<uint(date.Month())) == 0 || !s.dayMatches(date) {
+			continue
+		}
+		for hour := 0; hour < 24; hour++ {
+			if s.hour&(1<<uint(hour)) == 0 {
+				continue
+			}
+			for minute := 0; minute < 60; minute++ {
+				if s.minute&(1<<uint(minute)) == 0 {
+					continue
+				}
+				next := time.Date(date.Year(), date.Month(), date.Day(), hour, minute, 0, 0, loc)
+				if next.Hour() != hour || next.Minute() != minute {
+					// The time was skipped; read it with the offset from before the change
+					_, offset := next.Add(-2 * time.Hour).Zone()
+					next = time.Date(date.Year(), date.Month(), date.Day(), hour, minute, 0, 0, time.FixedZone("", offset)).In(loc)
+				}
+				if next.After(t) {
+					return next
+				}
+			}
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCronErrors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * 32 * *",
+		"* * * 0 *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"a * * * *",
+		"1,,2 * * * *",
+		"@every 5m",
+	} {
+		if _, err := parseCron(expr); err == nil {
+			t.Errorf("parseCron(%q) succeeded, want an error", expr)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	// 2026-01-15 is a Thursday
+	from := time.Date(2026, 1, 15, 10, 7, 0, 0, time.UTC)
+	tests := []struct {
+		expr string
+		from time.Time
+		want time.Time
+	}{
+		{"* * * * *", from, time.Date(2026, 1, 15, 10, 8, 0, 0, time.UTC)},
+		{"*/15 * * * *", from, time.Date(2026, 1, 15, 10, 15, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2026, 1, 15, 10, 15, 0, 0, time.UTC), time.Date(2026, 1, 15, 10, 30, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2026, 1, 15, 10, 14, 30, 0, time.UTC), time.Date(2026, 1, 15, 10, 15, 0, 0, time.UTC)},
+		{"5/20 * * * *", from, time.Date(2026, 1, 15, 10, 25, 0, 0, time.UTC)},
+		{"0 9-17/2 * * *", from, time.Date(2026, 1, 15, 11, 0, 0, 0, time.UTC)},
+		{"0 9-17/2 * * *", time.Date(2026, 1, 15, 17, 0, 0, 0, time.UTC), time.Date(2026, 1, 16, 9, 0, 0, 0, time.UTC)},
+		{"15,45 8,20 * * *", from, time.Date(2026, 1, 15, 20, 15, 0, 0, time.UTC)},
+		{"0 9 * * 1-5", time.Date(2026, 1, 16, 10, 0, 0, 0, time.UTC), time.Date(2026, 1, 19, 9, 0, 0, 0, time.UTC)},
+		{"0 0 * * 0", from, time.Date(2026, 1, 18, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", from, time.Date(2026, 1, 18, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1,15 * *", from, time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * 3-4 *", from, time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 31 * *", time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC), time.Date(2026, 5, 31, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", from, time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 31 12 *", time.Date(2026, 12, 31, 0, 0, 0, 0, time.UTC), time.Date(2027, 12, 31, 0, 0, 0, 0, time.UTC)},
+		// Restricting both day fields matches either: the 13th, or any Friday
+		{"0 0 13 * 5", time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{"0 0 13 * 5", time.Date(2026, 1, 9, 0, 0, 0, 0, time.UTC), time.Date(2026, 1, 13, 0, 0, 0, 0, time.UTC)},
+		// A restricted day of month with any day of week matches the day of month only
+		{"0 0 20 * *", from, time.Date(2026, 1, 20, 0, 0, 0, 0, time.UTC)},
+		{"@hourly", from, time.Date(2026, 1, 15, 11, 0, 0, 0, time.UTC)},
+		{"@daily", from, time.Date(2026, 1, 16, 0, 0, 0, 0, time.UTC)},
+		{"@weekly", from, time.Date(2026, 1, 18, 0, 0, 0, 0, time.UTC)},
+		{"@monthly", from, time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"@yearly", from, time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		s, err := parseCron(tt.expr)
+		if err != nil {
+			t.Errorf("parseCron(%q): %v", tt.expr, err)
+			continue
+		}
+		if got := s.Next(tt.from); !got.Equal(tt.want) {
+			t.Errorf("%q.Next(%v) = %v, want %v", tt.expr, tt.from, got, tt.want)
+		}
+	}
+}
+
+func TestCronNextNever(t *testing.T) {
+	s, err := parseCron("0 0 30 2 *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := s.Next(time.Now()); !got.IsZero() {
+		t.Errorf("Next = %v, want the zero time", got)
+	}
+}
+
+func TestCronNextDST(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	utc := func(year int, month time.Month, day, hour, minute int) time.Time {
+		return time.Date(year, month, day, hour, minute, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		name string
+		expr string
+		from time.Time
+		want []time.Time
+	}{
+		// Clocks go from 02:00 EST to 03:00 EDT on 2026-03-08
+		{"skipped time runs after the change", "30 2 * * *", utc(2026, 3, 7, 4, 0), []time.Time{
+			utc(2026, 3, 7, 7, 30), utc(2026, 3, 8, 7, 30), utc(2026, 3, 9, 6, 30),
+		}},
+		{"hourly across the gap", "0 * * * *", utc(2026, 3, 8, 5, 30), []time.Time{
+			utc(2026, 3, 8, 6, 0), utc(2026, 3, 8, 7, 0), utc(2026, 3, 8, 8, 0),
+		}},
+		// Clocks go from 02:00 EDT back to 01:00 EST on 2026-11-01
+		{"repeated time runs once", "30 1 * * *", utc(2026, 10, 31, 4, 0), []time.Time{
+			utc(2026, 10, 31, 5, 30), utc(2026, 11, 1, 5, 30), utc(2026, 11, 2, 6, 30),
+		}},
+		{"hourly across the overlap", "0 * * * *", utc(2026, 11, 1, 4, 30), []time.Time{
+			utc(2026, 11, 1, 5, 0), utc(2026, 11, 1, 7, 0), utc(2026, 11, 1, 8, 0),
+		}},
+	}
+	for _, tt := range tests {
+		s, err := parseCron(tt.expr)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		from := tt.from.In(loc)
+		for _, want := range tt.want {
+			got := s.Next(from)
+			if !got.Equal(want) {
+				t.Errorf("%s: Next(%v) = %v, want %v", tt.name, from, got.UTC(), want)
+				break
+			}
+			if got.Location() != loc {
+				t.Errorf("%s: Next(%v) is in %v, want %v", tt.name, from, got.Location(), loc)
+			}
+			from = got
+		}
+	}
+}
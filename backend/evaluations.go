@@ -0,0 +1,759 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	evaluationKinds         = []string{"midterm", "final"}
+	evaluationDirections    = []string{"mentor_to_intern", "intern_to_mentor"}
+	evaluationAnchors       = []string{"start", "end"}
+	evaluationQuestionTypes = []string{"rating", "text", "choice"}
+)
+
+// EvaluationQuestion is one entry of a template's form. Rating questions are scored
+// from 1 to Scale (default 5); choice questions accept one of Options.
+type EvaluationQuestion struct {
+	ID       string   `json:"id"`
+	Label    string   `json:"label"`
+	Type     string   `json:"type"`
+	Required bool     `json:"required"`
+	Options  []string `json:"options,omitempty"`
+	Scale    int      `json:"scale,omitempty"`
+}
+
+// EvaluationTemplate defines a form and when it is due. The window opens OffsetDays
+// after the internship's start or end date (Anchor) and stays open for WindowDays.
+type EvaluationTemplate struct {
+	ID             int                  `json:"id" db:"id"`
+	OrganizationID *int                 `json:"organization_id" db:"organization_id"`
+	Name           string               `json:"name" db:"name"`
+	Kind           string               `json:"kind" db:"kind"`
+	Direction      string               `json:"direction" db:"direction"`
+	Questions      []EvaluationQuestion `json:"questions" db:"questions"`
+	Anchor         string               `json:"anchor" db:"anchor"`
+	OffsetDays     int                  `json:"offset_days" db:"offset_days"`
+	WindowDays     int                  `json:"window_days" db:"window_days"`
+	Active         bool                 `json:"active" db:"active"`
+	CreatedBy      *int                 `json:"created_by" db:"created_by"`
+	CreatedAt      time.Time            `json:"created_at" db:"created_at"`
+	UpdatedAt      *time.Time           `json:"updated_at" db:"updated_at"`
+}
+
+type EvaluationTemplateRequest struct {
+	Name       string               `json:"name" binding:"required"`
+	Kind       string               `json:"kind" binding:"required"`
+	Direction  string               `json:"direction" binding:"required"`
+	Questions  []EvaluationQuestion `json:"questions" binding:"required"`
+	Anchor     string               `json:"anchor" binding:"required"`
+	OffsetDays int                  `json:"offset_days"`
+	WindowDays int                  `json:"window_days"`
+	Active     *bool                `json:"active"`
+	// OrganizationID limits the template to one organization; only global admins
+	// choose it; org admins' templates always belong to their organization
+	OrganizationID *int `json:"organization_id"`
+}
+
+type Evaluation struct {
+	ID              int                    `json:"id" db:"id"`
+	TemplateID      int                    `json:"template_id" db:"template_id"`
+	TemplateName    string                 `json:"template_name"`
+	Kind            string                 `json:"kind"`
+	Direction       string                 `json:"direction"`
+	ApplicationID   int                    `json:"application_id" db:"application_id"`
+	InternshipID    int                    `json:"internship_id"`
+	InternshipTitle string                 `json:"internship_title"`
+	EvaluatorID     int                    `json:"evaluator_id" db:"evaluator_id"`
+	EvaluatorName   string                 `json:"evaluator_name"`
+	EvaluateeID     int                    `json:"evaluatee_id" db:"evaluatee_id"`
+	EvaluateeName   string                 `json:"evaluatee_name"`
+	OpensOn         string                 `json:"opens_on" db:"opens_on"`
+	DueOn           string                 `json:"due_on" db:"due_on"`
+	WindowOpen      bool                   `json:"window_open"`
+	Status          string                 `json:"status" db:"status"`
+	Questions       []EvaluationQuestion   `json:"questions" db:"questions"`
+	Answers         map[string]interface{} `json:"answers" db:"answers"`
+	OverallRating   *float64               `json:"overall_rating" db:"overall_rating"`
+	SubmittedAt     *time.Time             `json:"submitted_at" db:"submitted_at"`
+	UpdatedAt       *time.Time             `json:"updated_at" db:"updated_at"`
+	CreatedAt       time.Time              `json:"created_at" db:"created_at"`
+}
+
+type EvaluationAnswersRequest struct {
+	Answers map[string]interface{} `json:"answers"`
+}
+
+// evaluationScope narrows scheduleEvaluations; zero fields match everything.
+type evaluationScope struct {
+	TemplateID    int
+	ApplicationID int
+	InternshipID  int
+}
+
+func init() {
+	onDomainEvent(scheduleAcceptedEvaluations)
+}
+
+const evaluationTemplateSelect = `
+	SELECT id, organization_id, name, kind, direction, questions, anchor, offset_days, window_days, active, created_by, created_at, updated_at
+	FROM evaluation_templates
+`
+
+func scanEvaluationTemplate(row interface{ Scan(...interface{}) error }) (EvaluationTemplate, error) {
+	var t EvaluationTemplate
+	var questions []byte
+	err := row.Scan(&t.ID, &t.OrganizationID, &t.Name, &t.Kind, &t.Direction, &questions, &t.Anchor, &t.OffsetDays, &t.WindowDays,
+		&t.Active, &t.CreatedBy, &t.CreatedAt, &t.UpdatedAt)
+	if err != nil {
+		return t, err
+	}
+	err = json.Unmarshal(questions, &t.Questions)
+	return t, err
+}
+
+// Submitted evaluations keep the questions they were answered against, so later
+// template edits do not change completed forms.
+const evaluationSelect = `
+	SELECT e.id, e.template_id, t.name, t.kind, t.direction, e.application_id, a.internship_id, i.title,
+	       e.evaluator_id, evaluator.name, e.evaluatee_id, evaluatee.name,
+	       to_char(e.opens_on, 'YYYY-MM-DD'), to_char(e.due_on, 'YYYY-MM-DD'),
+	       CURRENT_DATE BETWEEN e.opens_on AND e.due_on, e.status,
+	       COALESCE(e.questions, t.questions), e.answers, e.overall_rating, e.submitted_at, e.updated_at, e.created_at
+	FROM evaluations e
+	JOIN evaluation_templates t ON t.id = e.template_id
+	JOIN applications a ON a.id = e.application_id
+	JOIN internships i ON i.id = a.internship_id
+	JOIN users evaluator ON evaluator.id = e.evaluator_id
+	JOIN users evaluatee ON evaluatee.id = e.evaluatee_id
+`
+
+func scanEvaluation(row interface{ Scan(...interface{}) error }) (Evaluation, error) {
+	var e Evaluation
+	var questions, answers []byte
+	err := row.Scan(&e.ID, &e.TemplateID, &e.TemplateName, &e.Kind, &e.Direction, &e.ApplicationID, &e.InternshipID,
+		&e.InternshipTitle, &e.EvaluatorID, &e.EvaluatorName, &e.EvaluateeID, &e.EvaluateeName,
+		&e.OpensOn, &e.DueOn, &e.WindowOpen, &e.Status,
+		&questions, &answers, &e.OverallRating, &e.SubmittedAt, &e.UpdatedAt, &e.CreatedAt)
+	if err != nil {
+		return e, err
+	}
+	if err := json.Unmarshal(questions, &e.Questions); err != nil {
+		return e, err
+	}
+	e.Answers = map[string]interface{}{}
+	if answers != nil {
+		err = json.Unmarshal(answers, &e.Answers)
+	}
+	return e, err
+}
+
+func validateEvaluationTemplate(req *EvaluationTemplateRequest) error {
+	switch {
+	case !contains(evaluationKinds, req.Kind):
+		return fmt.Errorf("kind must be one of: %s", strings.Join(evaluationKinds, ", "))
+	case !contains(evaluationDirections, req.Direction):
+		return fmt.Errorf("direction must be one of: %s", strings.Join(evaluationDirections, ", "))
+	case !contains(evaluationAnchors, req.Anchor):
+		return fmt.Errorf("anchor must be one of: %s", strings.Join(evaluationAnchors, ", "))
+	case len(req.Questions) == 0:
+		return fmt.Errorf("at least one question is required")
+	}
+	if req.WindowDays == 0 {
+		req.WindowDays = 14
+	}
+	if req.WindowDays < 1 || req.WindowDays > 90 {
+		return fmt.Errorf("window_days must be between 1 and 90")
+	}
+
+	seen := map[string]bool{}
+	for i := range req.Questions {
+		q := &req.Questions[i]
+		q.ID = strings.TrimSpace(q.ID)
+		if q.ID == "" || strings.TrimSpace(q.Label) == "" {
+			return fmt.Errorf("question %d needs an id and a label", i+1)
+		}
+		if seen[q.ID] {
+			return fmt.Errorf("duplicate question id %q", q.ID)
+		}
+		seen[q.ID] = true
+
+		switch q.Type {
+		case "rating":
+			if q.Scale == 0 {
+				q.Scale = 5
+			}
+			if q.Scale < 2 || q.Scale > 10 {
+				return fmt.Errorf("question %q: scale must be between 2 and 10", q.ID)
+			}
+			q.Options = nil
+		case "choice":
+			if len(q.Options) < 2 {
+				return fmt.Errorf("question %q: choice questions need at least two options", q.ID)
+			}
+			q.Scale = 0
+		case "text":
+			q.Options, q.Scale = nil, 0
+		default:
+			return fmt.Errorf("question %q: type must be one of: %s", q.ID, strings.Join(evaluationQuestionTypes, ", "))
+		}
+	}
+	return nil
+}
+
+// validateEvaluationAnswers checks answers against the questions. Drafts may leave
+// required questions unanswered; submissions may not.
+func validateEvaluationAnswers(questions []EvaluationQuestion, answers map[string]interface{}, complete bool) error {
+	byID := map[string]EvaluationQuestion{}
+	for _, q := range questions {
+		byID[q.ID] = q
+	}
+	for id := range answers {
+		if _, ok := byID[id]; !ok {
+			return fmt.Errorf("unknown question %q", id)
+		}
+	}
+
+	for _, q := range questions {
+		answer, present := answers[q.ID]
+		if !present || answer == nil {
+			if complete && q.Required {
+				return fmt.Errorf("%q is required", q.Label)
+			}
+			continue
+		}
+
+		switch q.Type {
+		case "rating":
+			v, ok := answer.(float64)
+			if !ok || v != math.Trunc(v) || v < 1 || v > float64(q.Scale) {
+				return fmt.Errorf("%q must be a whole number from 1 to %d", q.Label, q.Scale)
+			}
+		case "choice":
+			v, ok := answer.(string)
+			if !ok || !contains(q.Options, v) {
+				return fmt.Errorf("%q must be one of: %s", q.Label, strings.Join(q.Options, ", "))
+			}
+		case "text":
+			v, ok := answer.(string)
+			if !ok {
+				return fmt.Errorf("%q must be text", q.Label)
+			}
+			if complete && q.Required && strings.TrimSpace(v) == "" {
+				return fmt.Errorf("%q is required", q.Label)
+			}
+		}
+	}
+	return nil
+}
+
+// overallRating averages the rating answers, normalized to a five point scale.
+func overallRating(questions []EvaluationQuestion, answers map[string]interface{}) *float64 {
+	var total float64
+	var count int
+	for _, q := range questions {
+		if v, ok := answers[q.ID].(float64); ok && q.Type == "rating" {
+			total += v / float64(q.Scale) * 5
+			count++
+		}
+	}
+	if count == 0 {
+		return nil
+	}
+	rating := math.Round(total/float64(count)*100) / 100
+	return &rating
+}
+
+// scheduleEvaluations creates an evaluation for every active template and accepted
+// application in scope whose internship has the anchor date set. Pending evaluations
+// get their window recomputed, so this is also called when dates or timing change.
+func scheduleEvaluations(ex sqlExecer, scope evaluationScope) error {
+	_, err := ex.Exec(`
+		INSERT INTO evaluations (template_id, application_id, evaluator_id, evaluatee_id, opens_on, due_on)
+		SELECT t.id, a.id,
+		       CASE WHEN t.direction = 'mentor_to_intern' THEN i.mentor_id ELSE a.student_id END,
+		       CASE WHEN t.direction = 'mentor_to_intern' THEN a.student_id ELSE i.mentor_id END,
+		       anchor.day + t.offset_days,
+		       anchor.day + t.offset_days + t.window_days - 1
+		FROM evaluation_templates t
+		CROSS JOIN applications a
+		JOIN internships i ON i.id = a.internship_id
+		CROSS JOIN LATERAL (SELECT CASE WHEN t.anchor = 'start' THEN i.start_date ELSE i.end_date END AS day) anchor
+		WHERE t.active AND a.status = 'accepted' AND anchor.day IS NOT NULL AND i.mentor_id IS NOT NULL
+		  AND (t.organization_id IS NULL OR t.organization_id = i.organization_id)
+		  AND ($1 = 0 OR t.id = $1) AND ($2 = 0 OR a.id = $2) AND ($3 = 0 OR i.id = $3)
+		ON CONFLICT (template_id, application_id, evaluator_id) DO UPDATE
+		SET opens_on = EXCLUDED.opens_on, due_on = EXCLUDED.due_on, opened_notified_at = NULL
+		WHERE evaluations.status = 'pending'
+		  AND (evaluations.opens_on, evaluations.due_on) IS DISTINCT FROM (EXCLUDED.opens_on, EXCLUDED.due_on)
+	`, scope.TemplateID, scope.ApplicationID, scope.InternshipID)
+	return err
+}
+
+// scheduleAcceptedEvaluations schedules evaluations once an application is accepted.
+func scheduleAcceptedEvaluations(tx *sql.Tx, event DomainEvent) error {
+	if event.Type != EventApplicationStatusChanged || event.Data["status"] != "accepted" {
+		return nil
+	}
+	applicationID, ok := event.Data["application_id"].(int)
+	if !ok {
+		return nil
+	}
+	return scheduleEvaluations(tx, evaluationScope{ApplicationID: applicationID})
+}
+
+func getEvaluationTemplates(c *gin.Context) {
+	rows, err := db.Query(evaluationTemplateSelect+`
+		WHERE ($1 = '' OR kind = $1) AND ($2 = 'true' OR active)
+		  AND ($3 = 0 OR organization_id IS NULL OR organization_id = $3)
+		ORDER BY kind, name
+	`, c.Query("kind"), c.Query("include_inactive"), tenantScope(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	templates := []EvaluationTemplate{}
+	for rows.Next() {
+		t, err := scanEvaluationTemplate(rows)
+		if err != nil {
+			continue
+		}
+		templates = append(templates, t)
+	}
+
+	c.JSON(http.StatusOK, templates)
+}
+
+func createEvaluationTemplate(c *gin.Context) {
+	var req EvaluationTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateEvaluationTemplate(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	questions, err := json.Marshal(req.Questions)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	active := req.Active == nil || *req.Active
+	organizationID := req.OrganizationID
+	if currentUserRole(c) != "admin" {
+		id := currentOrganizationID(c)
+		organizationID = &id
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	var id int
+	err = tx.QueryRow(`
+		INSERT INTO evaluation_templates (name, kind, direction, questions, anchor, offset_days, window_days, active, created_by, organization_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING id
+	`, req.Name, req.Kind, req.Direction, questions, req.Anchor, req.OffsetDays, req.WindowDays, active, currentUserID(c), organizationID).Scan(&id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Internships already under way get the new evaluation too
+	if err := scheduleEvaluations(tx, evaluationScope{TemplateID: id}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"id": id, "message": "Evaluation template created successfully"})
+}
+
+func updateEvaluationTemplate(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+	var req EvaluationTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateEvaluationTemplate(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	questions, err := json.Marshal(req.Questions)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	// Direction decides who evaluates whom, so it cannot change once forms exist. Org
+	// admins can only edit their organization's templates.
+	var direction string
+	var scheduled int
+	err = tx.QueryRow(`
+		SELECT t.direction, (SELECT COUNT(*) FROM evaluations WHERE template_id = t.id)
+		FROM evaluation_templates t WHERE t.id = $1 AND ($2 = 0 OR t.organization_id = $2) FOR UPDATE
+	`, id, tenantScope(c)).Scan(&direction, &scheduled)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Evaluation template not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if scheduled > 0 && direction != req.Direction {
+		c.JSON(http.StatusConflict, gin.H{"error": "Direction cannot change once evaluations have been scheduled"})
+		return
+	}
+
+	_, err = tx.Exec(`
+		UPDATE evaluation_templates SET name = $1, kind = $2, direction = $3, questions = $4, anchor = $5,
+		       offset_days = $6, window_days = $7, active = COALESCE($8, active), updated_at = CURRENT_TIMESTAMP
+		WHERE id = $9
+	`, req.Name, req.Kind, req.Direction, questions, req.Anchor, req.OffsetDays, req.WindowDays, req.Active, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := scheduleEvaluations(tx, evaluationScope{TemplateID: id}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Evaluation template updated successfully"})
+}
+
+// deleteEvaluationTemplate deactivates the template. Evaluations already scheduled
+// from it are kept.
+func deleteEvaluationTemplate(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+
+	result, err := db.Exec(
+		"UPDATE evaluation_templates SET active = FALSE, updated_at = CURRENT_TIMESTAMP WHERE id = $1 AND ($2 = 0 OR organization_id = $2)",
+		id, tenantScope(c),
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Evaluation template not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Evaluation template deactivated"})
+}
+
+// getEvaluations lists the evaluations the caller has to complete and the submitted
+// evaluations about them. Admins see all evaluations.
+func getEvaluations(c *gin.Context) {
+	rows, err := db.Query(evaluationSelect+`
+		WHERE ($1 IN ('admin', 'org_admin') OR e.evaluator_id = $2 OR (e.evaluatee_id = $2 AND e.status = 'submitted'))
+		  AND ($5 = 0 OR i.organization_id = $5)
+		  AND ($3 = '' OR e.status = $3)
+		  AND ($4 = '' OR e.application_id::text = $4)
+		ORDER BY e.due_on, e.id
+	`, currentUserRole(c), currentUserID(c), c.Query("status"), c.Query("application_id"), tenantScope(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	evaluations := []Evaluation{}
+	for rows.Next() {
+		e, err := scanEvaluation(rows)
+		if err != nil {
+			continue
+		}
+		evaluations = append(evaluations, e)
+	}
+
+	c.JSON(http.StatusOK, evaluations)
+}
+
+// loadEvaluation fetches an evaluation the caller may read. The evaluatee only sees it
+// once it has been submitted.
+func loadEvaluation(c *gin.Context) (Evaluation, bool) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return Evaluation{}, false
+	}
+
+	e, err := scanEvaluation(db.QueryRow(evaluationSelect+" WHERE e.id = $1 AND ($2 = 0 OR i.organization_id = $2)", id, tenantScope(c)))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Evaluation not found"})
+		return e, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return e, false
+	}
+
+	userID := currentUserID(c)
+	visible := isAdmin(c) || e.EvaluatorID == userID ||
+		(e.EvaluateeID == userID && e.Status == "submitted")
+	if !visible {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Evaluation not found"})
+		return e, false
+	}
+	return e, true
+}
+
+func getEvaluation(c *gin.Context) {
+	e, ok := loadEvaluation(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, e)
+}
+
+// saveEvaluationDraft stores partial answers while the evaluation is pending.
+func saveEvaluationDraft(c *gin.Context) {
+	writeEvaluation(c, false)
+}
+
+func submitEvaluation(c *gin.Context) {
+	writeEvaluation(c, true)
+}
+
+// writeEvaluation saves or submits the evaluator's answers. Answers can only be given
+// while the window is open, and submitted evaluations are locked.
+func writeEvaluation(c *gin.Context, submit bool) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+	var req EvaluationAnswersRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !(submit && c.Request.ContentLength == 0) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	e, err := scanEvaluation(tx.QueryRow(evaluationSelect+" WHERE e.id = $1 FOR UPDATE OF e", id))
+	if err == sql.ErrNoRows || (err == nil && e.EvaluatorID != currentUserID(c)) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Evaluation not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if e.Status == "submitted" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Evaluation has already been submitted"})
+		return
+	}
+	if !e.WindowOpen {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Evaluation window is %s to %s", e.OpensOn, e.DueOn)})
+		return
+	}
+
+	// Submitting without a body submits the saved draft
+	answers := req.Answers
+	if answers == nil {
+		answers = e.Answers
+	}
+	if err := validateEvaluationAnswers(e.Questions, answers, submit); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	answersJSON, err := json.Marshal(answers)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !submit {
+		if _, err := tx.Exec("UPDATE evaluations SET answers = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2", answersJSON, id); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if err := tx.Commit(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Evaluation draft saved"})
+		return
+	}
+
+	questionsJSON, err := json.Marshal(e.Questions)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	rating := overallRating(e.Questions, answers)
+	_, err = tx.Exec(`
+		UPDATE evaluations SET status = 'submitted', answers = $1, questions = $2, overall_rating = $3,
+		       submitted_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $4
+	`, answersJSON, questionsJSON, rating, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	data := map[string]interface{}{
+		"evaluation_id":    id,
+		"application_id":   e.ApplicationID,
+		"template_name":    e.TemplateName,
+		"internship_title": e.InternshipTitle,
+		"evaluator_name":   e.EvaluatorName,
+	}
+	if err := dispatchEvent(tx, DomainEvent{Type: EventEvaluationSubmitted, ActorID: e.EvaluatorID, Recipients: []int{e.EvaluateeID}, Data: data}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	publishRealtime(EventEvaluationSubmitted, []int{e.EvaluateeID}, data)
+	c.JSON(http.StatusOK, gin.H{"message": "Evaluation submitted successfully", "overall_rating": rating})
+}
+
+// exportEvaluationPDF renders a submitted evaluation as a PDF document.
+func exportEvaluationPDF(c *gin.Context) {
+	e, ok := loadEvaluation(c)
+	if !ok {
+		return
+	}
+	if e.Status != "submitted" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Only submitted evaluations can be exported"})
+		return
+	}
+
+	c.Header("Content-Type", "application/pdf")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="evaluation-%d.pdf"`, e.ID))
+
+	pdf := NewPDFWriter(c.Writer)
+	pdf.Heading(e.TemplateName, 18)
+	pdf.Field("Internship", e.InternshipTitle, 11)
+	pdf.Field("Evaluator", e.EvaluatorName, 11)
+	pdf.Field("Evaluated", e.EvaluateeName, 11)
+	if e.SubmittedAt != nil {
+		pdf.Field("Submitted", e.SubmittedAt.Format("January 2, 2006"), 11)
+	}
+	if e.OverallRating != nil {
+		pdf.Field("Overall rating", fmt.Sprintf("%.2f / 5", *e.OverallRating), 11)
+	}
+	pdf.Space(10)
+
+	for _, q := range e.Questions {
+		answer := "Not answered"
+		switch v := e.Answers[q.ID].(type) {
+		case float64:
+			answer = fmt.Sprintf("%d / %d", int(v), q.Scale)
+		case string:
+			if strings.TrimSpace(v) != "" {
+				answer = v
+			}
+		}
+		pdf.Field(q.Label, answer, 11)
+	}
+
+	if err := pdf.Close(); err != nil {
+		log.Printf("Error writing evaluation %d PDF: %v", e.ID, err)
+	}
+}
+
+// sendEvaluationReminders notifies evaluators once an evaluation window opens.
+func sendEvaluationReminders() (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`
+		SELECT e.id, e.application_id, e.evaluator_id, t.name, i.title, to_char(e.due_on, 'Mon FMDD, YYYY')
+		FROM evaluations e
+		JOIN evaluation_templates t ON t.id = e.template_id
+		JOIN applications a ON a.id = e.application_id
+		JOIN internships i ON i.id = a.internship_id
+		WHERE e.status = 'pending' AND e.opened_notified_at IS NULL
+		  AND CURRENT_DATE BETWEEN e.opens_on AND e.due_on
+		FOR UPDATE OF e SKIP LOCKED
+	`)
+	if err != nil {
+		return 0, err
+	}
+
+	var events []DomainEvent
+	for rows.Next() {
+		var id, applicationID, evaluatorID int
+		var name, title, dueOn string
+		if err := rows.Scan(&id, &applicationID, &evaluatorID, &name, &title, &dueOn); err != nil {
+			continue
+		}
+		events = append(events, DomainEvent{
+			Type:       EventEvaluationOpened,
+			Recipients: []int{evaluatorID},
+			Data: map[string]interface{}{
+				"evaluation_id":    id,
+				"application_id":   applicationID,
+				"template_name":    name,
+				"internship_title": title,
+				"due_on":           dueOn,
+			},
+		})
+	}
+	rows.Close()
+
+	for _, event := range events {
+		if err := dispatchEvent(tx, event); err != nil {
+			return 0, err
+		}
+		if _, err := tx.Exec("UPDATE evaluations SET opened_notified_at = CURRENT_TIMESTAMP WHERE id = $1", event.Data["evaluation_id"]); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(events), tx.Commit()
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"database/sql"
+)
+
+const (
+	EventMessageCreated           = "message.created"
+	EventInternshipCreated        = "internship.created"
+	EventApplicationCreated       = "application.created"
+	EventApplicationStatusChanged = "application.status_changed"
+	EventInterviewScheduled       = "application.interview_scheduled"
+	EventDeadlineApproaching      = "internship.deadline_approaching"
+	EventMentorshipRequested      = "mentorship.requested"
+	EventMentorshipAccepted       = "mentorship.accepted"
+	EventMentorshipDeclined       = "mentorship.declined"
+	EventMentorshipEnded          = "mentorship.ended"
+	EventMeetingBooked            = "meeting.booked"
+	EventMeetingCancelled         = "meeting.cancelled"
+	EventMeetingRescheduled       = "meeting.rescheduled"
+	EventTimesheetSubmitted       = "timesheet.submitted"
+	EventTimesheetApproved        = "timesheet.approved"
+	EventTimesheetRejected        = "timesheet.rejected"
+	EventGoalAssigned             = "goal.assigned"
+	EventMilestoneCompleted       = "milestone.completed"
+	EventEvaluationOpened         = "evaluation.opened"
+	EventEvaluationSubmitted      = "evaluation.submitted"
+	EventSavedSearchMatched       = "saved_search.matched"
+	EventInternshipClosed         = "internship.closed"
+	EventInternshipPublished      = "internship.published"
+)
+
+// DomainEvent describes a change other subsystems react to. Recipients are the users
+// the event concerns; Data carries the fields needed to describe it.
+type DomainEvent struct {
+	Type       string
+	ActorID    int
+	Recipients []int
+	Data       map[string]interface{}
+}
+
+// EventHandler reacts to a domain event inside the transaction that produced it, so
+// its side effects are committed or rolled back together with the change.
+type EventHandler func(tx *sql.Tx, event DomainEvent) error
+
+var eventHandlers []EventHandler
+
+// onDomainEvent registers a handler for every dispatched domain event.
+func onDomainEvent(handler EventHandler) {
+	eventHandlers = append(eventHandlers, handler)
+}
+
+// dispatchEvent runs all registered handlers in the caller's transaction.
+func dispatchEvent(tx *sql.Tx, event DomainEvent) error {
+	for _, handler := range eventHandlers {
+		if err := handler(tx, event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const earthRadiusKm = 6371.0
+
+// Place is a structured location to geocode. Empty parts are unknown.
+type Place struct {
+	City    string
+	Region  string
+	Country string
+}
+
+type Coordinates struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+// Geocoder resolves places to coordinates. Geocode returns nil for places it does
+// not know.
+type Geocoder interface {
+	Geocode(place Place) (*Coordinates, error)
+}
+
+// geocoder is the geocoder used by handlers and jobs, set up in main.
+var geocoder Geocoder
+
+// LookupGeocoder resolves places from an in-memory table, without network access.
+// Places match on city, region and country, falling back to fewer parts when those
+// still identify a single entry.
+type LookupGeocoder struct {
+	places    map[string]Coordinates
+	ambiguous map[string]bool
+}
+
+// geocoderPlaces seeds the lookup table with common internship locations.
+var geocoderPlaces = []struct {
+	Place
+	Coordinates
+}{
+	{Place{"San Francisco", "CA", "US"}, Coordinates{37.7749, -122.4194}},
+	{Place{"San Jose", "CA", "US"}, Coordinates{37.3382, -121.8863}},
+	{Place{"Mountain View", "CA", "US"}, Coordinates{37.3861, -122.0839}},
+	{Place{"Palo Alto", "CA", "US"}, Coordinates{37.4419, -122.1430}},
+	{Place{"Los Angeles", "CA", "US"}, Coordinates{34.0522, -118.2437}},
+	{Place{"San Diego", "CA", "US"}, Coordinates{32.7157, -117.1611}},
+	{Place{"Oakland", "CA", "US"}, Coordinates{37.8044, -122.2712}},
+	{Place{"Berkeley", "CA", "US"}, Coordinates{37.8715, -122.2730}},
+	{Place{"Sunnyvale", "CA", "US"}, Coordinates{37.3688, -122.0363}},
+	{Place{"Santa Clara", "CA", "US"}, Coordinates{37.3541, -121.9552}},
+	{Place{"Sacramento", "CA", "US"}, Coordinates{38.5816, -121.4944}},
+	{Place{"Irvine", "CA", "US"}, Coordinates{33.6846, -117.8265}},
+	{Place{"Seattle", "WA", "US"}, Coordinates{47.6062, -122.3321}},
+	{Place{"Portland", "OR", "US"}, Coordinates{45.5152, -122.6784}},
+	{Place{"Denver", "CO", "US"}, Coordinates{39.7392, -104.9903}},
+	{Place{"Austin", "TX", "US"}, Coordinates{30.2672, -97.7431}},
+	{Place{"Dallas", "TX", "US"}, Coordinates{32.7767, -96.7970}},
+	{Place{"Houston", "TX", "US"}, Coordinates{29.7604, -95.3698}},
+	{Place{"Chicago", "IL", "US"}, Coordinates{41.8781, -87.6298}},
+	{Place{"Indianapolis", "IN", "US"}, Coordinates{39.7684, -86.1581}},
+	{Place{"Boston", "MA", "US"}, Coordinates{42.3601, -71.0589}},
+	{Place{"Cambridge", "MA", "US"}, Coordinates{42.3736, -71.1097}},
+	{Place{"New York", "NY", "US"}, Coordinates{40.7128, -74.0060}},
+	{Place{"Philadelphia", "PA", "US"}, Coordinates{39.9526, -75.1652}},
+	{Place{"Wilmington", "DE", "US"}, Coordinates{39.7391, -75.5398}},
+	{Place{"Pittsburgh", "PA", "US"}, Coordinates{40.4406, -79.9959}},
+	{Place{"Washington", "DC", "US"}, Coordinates{38.9072, -77.0369}},
+	{Place{"Atlanta", "GA", "US"}, Coordinates{33.7490, -84.3880}},
+	{Place{"Miami", "FL", "US"}, Coordinates{25.7617, -80.1918}},
+	{Place{"Toronto", "ON", "CA"}, Coordinates{43.6532, -79.3832}},
+	{Place{"Vancouver", "BC", "CA"}, Coordinates{49.2827, -123.1207}},
+	{Place{"Montreal", "QC", "CA"}, Coordinates{45.5017, -73.5673}},
+	{Place{"London", "", "GB"}, Coordinates{51.5074, -0.1278}},
+	{Place{"Manchester", "", "GB"}, Coordinates{53.4808, -2.2426}},
+	{Place{"Cambridge", "", "GB"}, Coordinates{52.2053, 0.1218}},
+	{Place{"Dublin", "", "IE"}, Coordinates{53.3498, -6.2603}},
+	{Place{"Paris", "", "FR"}, Coordinates{48.8566, 2.3522}},
+	{Place{"Berlin", "", "DE"}, Coordinates{52.5200, 13.4050}},
+	{Place{"Munich", "", "DE"}, Coordinates{48.1351, 11.5820}},
+	{Place{"Hamburg", "", "DE"}, Coordinates{53.5511, 9.9937}},
+	{Place{"Amsterdam", "", "NL"}, Coordinates{52.3676, 4.9041}},
+	{Place{"Madrid", "", "ES"}, Coordinates{40.4168, -3.7038}},
+	{Place{"Barcelona", "", "ES"}, Coordinates{41.3874, 2.1686}},
+	{Place{"Milan", "", "IT"}, Coordinates{45.4642, 9.1900}},
+	{Place{"Rome", "", "IT"}, Coordinates{41.9028, 12.4964}},
+	{Place{"Zurich", "", "CH"}, Coordinates{47.3769, 8.5417}},
+	{Place{"Stockholm", "", "SE"}, Coordinates{59.3293, 18.0686}},
+	{Place{"Bangalore", "Karnataka", "IN"}, Coordinates{12.9716, 77.5946}},
+	{Place{"Bengaluru", "Karnataka", "IN"}, Coordinates{12.9716, 77.5946}},
+	{Place{"Mumbai", "Maharashtra", "IN"}, Coordinates{19.0760, 72.8777}},
+	{Place{"Hyderabad", "Telangana", "IN"}, Coordinates{17.3850, 78.4867}},
+	{Place{"New Delhi", "Delhi", "IN"}, Coordinates{28.6139, 77.2090}},
+	{Place{"", "", "SG"}, Coordinates{1.3521, 103.8198}},
+	{Place{"Singapore", "", "SG"}, Coordinates{1.3521, 103.8198}},
+	{Place{"Tokyo", "", "JP"}, Coordinates{35.6762, 139.6503}},
+	{Place{"Shanghai", "", "CN"}, Coordinates{31.2304, 121.4737}},
+	{Place{"Beijing", "", "CN"}, Coordinates{39.9042, 116.4074}},
+	{Place{"Sydney", "NSW", "AU"}, Coordinates{-33.8688, 151.2093}},
+	{Place{"Melbourne", "VIC", "AU"}, Coordinates{-37.8136, 144.9631}},
+	{Place{"Sao Paulo", "SP", "BR"}, Coordinates{-23.5505, -46.6333}},
+	{Place{"Mexico City", "", "MX"}, Coordinates{19.4326, -99.1332}},
+}
+
+func placeKey(city, region, country string) string {
+	return strings.ToLower(strings.TrimSpace(city)) + "|" + strings.ToLower(strings.TrimSpace(region)) + "|" +
+		strings.ToLower(strings.TrimSpace(country))
+}
+
+func NewLookupGeocoder() *LookupGeocoder {
+	g := &LookupGeocoder{places: map[string]Coordinates{}, ambiguous: map[string]bool{}}
+	for _, p := range geocoderPlaces {
+		g.Add(p.Place, p.Coordinates)
+	}
+	return g
+}
+
+// Add registers a place under its full key and the shorter keys that omit the region
+// or country. Shorter keys shared by places far apart are dropped as ambiguous.
+func (g *LookupGeocoder) Add(place Place, coordinates Coordinates) {
+	keys := []string{
+		placeKey(place.City, place.Region, place.Country),
+		placeKey(place.City, "", place.Country),
+		placeKey(place.City, place.Region, ""),
+		placeKey(place.City, "", ""),
+	}
+	for i, key := range keys {
+		if key == "||" || g.ambiguous[key] {
+			continue
+		}
+		existing, ok := g.places[key]
+		if i > 0 && ok && distanceKm(existing, coordinates) > 1 {
+			delete(g.places, key)
+			g.ambiguous[key] = true
+			continue
+		}
+		g.places[key] = coordinates
+	}
+}
+
+func (g *LookupGeocoder) Geocode(place Place) (*Coordinates, error) {
+	for _, key := range []string{
+		placeKey(place.City, place.Region, place.Country),
+		placeKey(place.City, "", place.Country),
+		placeKey(place.City, place.Region, ""),
+		placeKey(place.City, "", ""),
+	} {
+		if key == "||" {
+			continue
+		}
+		if coordinates, ok := g.places[key]; ok {
+			return &coordinates, nil
+		}
+	}
+	return nil, nil
+}
+
+// LoadCSV adds places from a CSV file with the columns city, region, country,
+// latitude and longitude. A header row is skipped.
+func (g *LookupGeocoder) LoadCSV(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		return err
+	}
+	for i, record := range records {
+		if len(record) != 5 {
+			return fmt.Errorf("%s line %d: expected 5 columns", path, i+1)
+		}
+		lat, latErr := strconv.ParseFloat(strings.TrimSpace(record[3]), 64)
+		lng, lngErr := strconv.ParseFloat(strings.TrimSpace(record[4]), 64)
+		if latErr != nil || lngErr != nil {
+			if i == 0 {
+				continue
+			}
+			return fmt.Errorf("%s line %d: invalid coordinates", path, i+1)
+		}
+		g.Add(Place{record[0], record[1], record[2]}, Coordinates{lat, lng})
+	}
+	return nil
+}
+
+// newGeocoder returns the lookup geocoder, extended with the places in
+// GEOCODER_TABLE if set.
+func newGeocoder() Geocoder {
+	g := NewLookupGeocoder()
+	if path := os.Getenv("GEOCODER_TABLE"); path != "" {
+		if err := g.LoadCSV(path); err != nil {
+			log.Printf("Error loading geocoder table: %v", err)
+		} else {
+			log.Printf("Loaded geocoder places from %s", path)
+		}
+	}
+	return g
+}
+
+// distanceKm returns the great-circle distance between two points.
+func distanceKm(a, b Coordinates) float64 {
+	lat1, lat2 := a.Latitude*math.Pi/180, b.Latitude*math.Pi/180
+	dLat := lat2 - lat1
+	dLng := (b.Longitude - a.Longitude) * math.Pi / 180
+	h := math.Pow(math.Sin(dLat/2), 2) + math.Cos(lat1)*math.Cos(lat2)*math.Pow(math.Sin(dLng/2), 2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(h))
+}
+
+// geocodeInternship sets the coordinates of an onsite or hybrid internship from its
+// location, unless the request gave them. Updates pass through reconcileCoordinates
+// first so stale coordinates are not taken as given. Internships the geocoder does not know
+// keep empty coordinates.
+func geocodeInternship(internship *Internship) error {
+	if internship.Latitude != nil || internship.Type == "remote" || geocoder == nil {
+		return nil
+	}
+	place := Place{derefOr(internship.City), derefOr(internship.Region), derefOr(internship.Country)}
+	if place == (Place{}) {
+		return nil
+	}
+	coordinates, err := geocoder.Geocode(place)
+	if err != nil || coordinates == nil {
+		return err
+	}
+	internship.Latitude, internship.Longitude = &coordinates.Latitude, &coordinates.Longitude
+	return nil
+}
+
+// reconcileCoordinates drops the stored coordinates sent back with an update that
+// moves the internship, so it is geocoded at its new location. Coordinates that
+// differ from the stored ones were given by the caller and are kept.
+func reconcileCoordinates(internship *Internship, stored Internship) {
+	moved := !samePtr(internship.City, stored.City) || !samePtr(internship.Region, stored.Region) ||
+		!samePtr(internship.Country, stored.Country)
+	if moved && samePtr(internship.Latitude, stored.Latitude) && samePtr(internship.Longitude, stored.Longitude) {
+		internship.Latitude, internship.Longitude = nil, nil
+	}
+}
+
+// geocodeInternships is a scheduler job that geocodes onsite and hybrid internships
+// without coordinates. Each location is tried once; updating an internship's
+// location makes it eligible again.
+func geocodeInternships() (int, error) {
+	rows, err := db.Query(`
+		SELECT id, type, city, region, country FROM internships
+		WHERE latitude IS NULL AND type <> 'remote' AND geocoded_at IS NULL
+		  AND (city IS NOT NULL OR country IS NOT NULL)
+		LIMIT 500
+	`)
+	if err != nil {
+		return 0, err
+	}
+	var internships []Internship
+	for rows.Next() {
+		var internship Internship
+		if err := rows.Scan(&internship.ID, &internship.Type, &internship.City, &internship.Region, &internship.Country); err != nil {
+			continue
+		}
+		internships = append(internships, internship)
+	}
+	rows.Close()
+
+	geocoded := 0
+	for _, internship := range internships {
+		if err := geocodeInternship(&internship); err != nil {
+			return geocoded, err
+		}
+		_, err := db.Exec(`
+			UPDATE internships SET latitude = $1, longitude = $2, geocoded_at = CURRENT_TIMESTAMP
+			WHERE id = $3 AND latitude IS NULL
+		`, internship.Latitude, internship.Longitude, internship.ID)
+		if err != nil {
+			return geocoded, err
+		}
+		if internship.Latitude != nil {
+			geocoded++
+		}
+	}
+	return geocoded, nil
+}
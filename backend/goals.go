@@ -0,0 +1,593 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+var goalStatuses = []string{"not_started", "in_progress", "completed", "blocked"}
+
+type Goal struct {
+	ID            int         `json:"id" db:"id"`
+	ApplicationID int         `json:"application_id" db:"application_id"`
+	Title         string      `json:"title" db:"title"`
+	Description   *string     `json:"description" db:"description"`
+	DueDate       *string     `json:"due_date" db:"due_date"`
+	Status        string      `json:"status" db:"status"`
+	Position      int         `json:"position" db:"position"`
+	CreatedBy     *int        `json:"created_by" db:"created_by"`
+	CreatedAt     time.Time   `json:"created_at" db:"created_at"`
+	UpdatedAt     *time.Time  `json:"updated_at" db:"updated_at"`
+	Milestones    []Milestone `json:"milestones"`
+}
+
+type Milestone struct {
+	ID            int        `json:"id" db:"id"`
+	GoalID        int        `json:"goal_id" db:"goal_id"`
+	Title         string     `json:"title" db:"title"`
+	Description   *string    `json:"description" db:"description"`
+	DueDate       *string    `json:"due_date" db:"due_date"`
+	Status        string     `json:"status" db:"status"`
+	EvidenceLinks []string   `json:"evidence_links" db:"evidence_links"`
+	InternNote    *string    `json:"intern_note" db:"intern_note"`
+	CompletedAt   *time.Time `json:"completed_at" db:"completed_at"`
+	UpdatedAt     *time.Time `json:"updated_at" db:"updated_at"`
+}
+
+type GoalRequest struct {
+	Title       string  `json:"title" binding:"required"`
+	Description *string `json:"description"`
+	DueDate     *string `json:"due_date"`
+	Position    int     `json:"position"`
+}
+
+type MilestoneRequest struct {
+	Title       string  `json:"title" binding:"required"`
+	Description *string `json:"description"`
+	DueDate     *string `json:"due_date"`
+}
+
+type ProgressUpdateRequest struct {
+	Status        string   `json:"status" binding:"required"`
+	EvidenceLinks []string `json:"evidence_links"`
+	Note          *string  `json:"note"`
+}
+
+type ProgressSummary struct {
+	ApplicationID       int        `json:"application_id"`
+	Goals               int        `json:"goals"`
+	GoalsCompleted      int        `json:"goals_completed"`
+	GoalsBlocked        int        `json:"goals_blocked"`
+	Milestones          int        `json:"milestones"`
+	MilestonesCompleted int        `json:"milestones_completed"`
+	MilestonesOverdue   int        `json:"milestones_overdue"`
+	PercentComplete     float64    `json:"percent_complete"`
+	NextDue             *Milestone `json:"next_due"`
+}
+
+// applicationParties returns the intern, mentor and organization of an application.
+func applicationParties(q sqlQueryer, applicationID int) (studentID, mentorID, organizationID int, status string, err error) {
+	err = q.QueryRow(`
+		SELECT a.student_id, i.mentor_id, COALESCE(i.organization_id, 0), a.status FROM applications a
+		JOIN internships i ON i.id = a.internship_id
+		WHERE a.id = $1
+	`, applicationID).Scan(&studentID, &mentorID, &organizationID, &status)
+	return
+}
+
+// goalApplication resolves the application a goal belongs to.
+func goalApplication(goalID int) (int, error) {
+	var applicationID int
+	err := db.QueryRow("SELECT application_id FROM goals WHERE id = $1", goalID).Scan(&applicationID)
+	return applicationID, err
+}
+
+// milestoneApplication resolves the goal and application a milestone belongs to.
+func milestoneApplication(milestoneID int) (int, int, error) {
+	var goalID, applicationID int
+	err := db.QueryRow(`
+		SELECT m.goal_id, g.application_id FROM milestones m JOIN goals g ON g.id = m.goal_id WHERE m.id = $1
+	`, milestoneID).Scan(&goalID, &applicationID)
+	return goalID, applicationID, err
+}
+
+// authorizeGoalAccess checks the caller against the application's parties. Mentors
+// (and admins of the organization) manage goals; interns can only read them and
+// update progress.
+func authorizeGoalAccess(c *gin.Context, applicationID int, manage bool) (studentID, mentorID int, ok bool) {
+	studentID, mentorID, organizationID, status, err := applicationParties(db, applicationID)
+	if scope := tenantScope(c); err == nil && scope != 0 && scope != organizationID {
+		err = sql.ErrNoRows
+	}
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Application not found"})
+		return 0, 0, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return 0, 0, false
+	}
+
+	userID := currentUserID(c)
+	isManager := userID == mentorID || isAdmin(c)
+	if !isManager && (manage || userID != studentID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+		return 0, 0, false
+	}
+	if manage && status != "accepted" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Goals can only be defined on accepted applications"})
+		return 0, 0, false
+	}
+	return studentID, mentorID, true
+}
+
+// validateDate checks that an optional date field is formatted as YYYY-MM-DD.
+func validateDate(field string, date *string) error {
+	if date != nil {
+		if _, err := time.Parse("2006-01-02", *date); err != nil {
+			return fmt.Errorf("%s must be YYYY-MM-DD", field)
+		}
+	}
+	return nil
+}
+
+func validateEvidenceLinks(links []string) error {
+	for _, link := range links {
+		u, err := url.Parse(link)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("evidence link %q must be an absolute http(s) URL", link)
+		}
+	}
+	return nil
+}
+
+func loadGoals(applicationID int) ([]Goal, error) {
+	rows, err := db.Query(`
+		SELECT id, application_id, title, description, to_char(due_date, 'YYYY-MM-DD'), status, position, created_by, created_at, updated_at
+		FROM goals WHERE application_id = $1 ORDER BY position, id
+	`, applicationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	goals := []Goal{}
+	index := map[int]int{}
+	for rows.Next() {
+		var g Goal
+		err := rows.Scan(&g.ID, &g.ApplicationID, &g.Title, &g.Description, &g.DueDate, &g.Status, &g.Position,
+			&g.CreatedBy, &g.CreatedAt, &g.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		g.Milestones = []Milestone{}
+		index[g.ID] = len(goals)
+		goals = append(goals, g)
+	}
+
+	milestones, err := db.Query(`
+		SELECT m.id, m.goal_id, m.title, m.description, to_char(m.due_date, 'YYYY-MM-DD'), m.status, m.evidence_links,
+		       m.intern_note, m.completed_at, m.updated_at
+		FROM milestones m JOIN goals g ON g.id = m.goal_id
+		WHERE g.application_id = $1
+		ORDER BY m.due_date NULLS LAST, m.id
+	`, applicationID)
+	if err != nil {
+		return nil, err
+	}
+	defer milestones.Close()
+
+	for milestones.Next() {
+		m, err := scanMilestone(milestones)
+		if err != nil {
+			return nil, err
+		}
+		if i, ok := index[m.GoalID]; ok {
+			goals[i].Milestones = append(goals[i].Milestones, m)
+		}
+	}
+	return goals, nil
+}
+
+func scanMilestone(row interface{ Scan(...interface{}) error }) (Milestone, error) {
+	var m Milestone
+	err := row.Scan(&m.ID, &m.GoalID, &m.Title, &m.Description, &m.DueDate, &m.Status, pq.Array(&m.EvidenceLinks),
+		&m.InternNote, &m.CompletedAt, &m.UpdatedAt)
+	if m.EvidenceLinks == nil {
+		m.EvidenceLinks = []string{}
+	}
+	return m, err
+}
+
+func getGoals(c *gin.Context) {
+	applicationID, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+	if _, _, ok := authorizeGoalAccess(c, applicationID, false); !ok {
+		return
+	}
+
+	goals, err := loadGoals(applicationID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, goals)
+}
+
+func createGoal(c *gin.Context) {
+	applicationID, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+	var req GoalRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateDate("due_date", req.DueDate); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	studentID, _, ok := authorizeGoalAccess(c, applicationID, true)
+	if !ok {
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	var id int
+	err = tx.QueryRow(`
+		INSERT INTO goals (application_id, title, description, due_date, position, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING id
+	`, applicationID, req.Title, req.Description, req.DueDate, req.Position, currentUserID(c)).Scan(&id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	data := map[string]interface{}{"goal_id": id, "application_id": applicationID, "title": req.Title}
+	if err := dispatchEvent(tx, DomainEvent{Type: EventGoalAssigned, ActorID: currentUserID(c), Recipients: []int{studentID}, Data: data}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"id": id, "message": "Goal created successfully"})
+}
+
+func updateGoal(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+	var req GoalRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateDate("due_date", req.DueDate); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	applicationID, err := goalApplication(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Goal not found"})
+		return
+	}
+	if _, _, ok := authorizeGoalAccess(c, applicationID, true); !ok {
+		return
+	}
+
+	_, err = db.Exec(`
+		UPDATE goals SET title = $1, description = $2, due_date = $3, position = $4, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $5
+	`, req.Title, req.Description, req.DueDate, req.Position, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Goal updated successfully"})
+}
+
+func deleteGoal(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+	applicationID, err := goalApplication(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Goal not found"})
+		return
+	}
+	if _, _, ok := authorizeGoalAccess(c, applicationID, true); !ok {
+		return
+	}
+
+	if _, err := db.Exec("DELETE FROM goals WHERE id = $1", id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Goal deleted successfully"})
+}
+
+// updateGoalStatus lets the intern (or mentor) report progress on a goal.
+func updateGoalStatus(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+	var req ProgressUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !contains(goalStatuses, req.Status) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status"})
+		return
+	}
+	applicationID, err := goalApplication(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Goal not found"})
+		return
+	}
+	if _, _, ok := authorizeGoalAccess(c, applicationID, false); !ok {
+		return
+	}
+
+	if _, err := db.Exec("UPDATE goals SET status = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2", req.Status, id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Goal status updated successfully"})
+}
+
+func createMilestone(c *gin.Context) {
+	goalID, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+	var req MilestoneRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateDate("due_date", req.DueDate); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	applicationID, err := goalApplication(goalID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Goal not found"})
+		return
+	}
+	if _, _, ok := authorizeGoalAccess(c, applicationID, true); !ok {
+		return
+	}
+
+	var id int
+	err = db.QueryRow(
+		"INSERT INTO milestones (goal_id, title, description, due_date) VALUES ($1, $2, $3, $4) RETURNING id",
+		goalID, req.Title, req.Description, req.DueDate,
+	).Scan(&id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"id": id, "message": "Milestone created successfully"})
+}
+
+func updateMilestone(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+	var req MilestoneRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateDate("due_date", req.DueDate); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	_, applicationID, err := milestoneApplication(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Milestone not found"})
+		return
+	}
+	if _, _, ok := authorizeGoalAccess(c, applicationID, true); !ok {
+		return
+	}
+
+	_, err = db.Exec(
+		"UPDATE milestones SET title = $1, description = $2, due_date = $3, updated_at = CURRENT_TIMESTAMP WHERE id = $4",
+		req.Title, req.Description, req.DueDate, id,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Milestone updated successfully"})
+}
+
+func deleteMilestone(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+	_, applicationID, err := milestoneApplication(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Milestone not found"})
+		return
+	}
+	if _, _, ok := authorizeGoalAccess(c, applicationID, true); !ok {
+		return
+	}
+
+	if _, err := db.Exec("DELETE FROM milestones WHERE id = $1", id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Milestone deleted successfully"})
+}
+
+// updateMilestoneStatus records the intern's progress on a milestone together with
+// links to evidence of the work. Completing a milestone notifies the mentor.
+func updateMilestoneStatus(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+	var req ProgressUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !contains([]string{"pending", "in_progress", "completed"}, req.Status) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status"})
+		return
+	}
+	if err := validateEvidenceLinks(req.EvidenceLinks); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	_, applicationID, err := milestoneApplication(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Milestone not found"})
+		return
+	}
+	_, mentorID, ok := authorizeGoalAccess(c, applicationID, false)
+	if !ok {
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	var title, previousStatus string
+	err = tx.QueryRow(`
+		UPDATE milestones m
+		SET status = $1,
+		    evidence_links = COALESCE($2, m.evidence_links),
+		    intern_note = COALESCE($3, m.intern_note),
+		    completed_at = CASE WHEN $1 = 'completed' THEN COALESCE(m.completed_at, CURRENT_TIMESTAMP) ELSE NULL END,
+		    updated_at = CURRENT_TIMESTAMP
+		FROM (SELECT status FROM milestones WHERE id = $4 FOR UPDATE) previous
+		WHERE m.id = $4
+		RETURNING m.title, previous.status
+	`, req.Status, nullableArray(req.EvidenceLinks), req.Note, id).Scan(&title, &previousStatus)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Status == "completed" && previousStatus != "completed" && currentUserID(c) != mentorID {
+		data := map[string]interface{}{"milestone_id": id, "application_id": applicationID, "title": title}
+		if err := dispatchEvent(tx, DomainEvent{Type: EventMilestoneCompleted, ActorID: currentUserID(c), Recipients: []int{mentorID}, Data: data}); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Milestone status updated successfully"})
+}
+
+// nullableArray passes nil slices as SQL NULL so COALESCE keeps the stored value.
+func nullableArray(values []string) interface{} {
+	if values == nil {
+		return nil
+	}
+	return pq.Array(values)
+}
+
+// getProgressSummary reports goal and milestone completion for an application, for
+// the intern and mentor dashboards.
+func getProgressSummary(c *gin.Context) {
+	applicationID, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+	if _, _, ok := authorizeGoalAccess(c, applicationID, false); !ok {
+		return
+	}
+
+	summary := ProgressSummary{ApplicationID: applicationID}
+	err := db.QueryRow(`
+		SELECT COUNT(*),
+		       COUNT(*) FILTER (WHERE status = 'completed'),
+		       COUNT(*) FILTER (WHERE status = 'blocked')
+		FROM goals WHERE application_id = $1
+	`, applicationID).Scan(&summary.Goals, &summary.GoalsCompleted, &summary.GoalsBlocked)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	err = db.QueryRow(`
+		SELECT COUNT(*),
+		       COUNT(*) FILTER (WHERE m.status = 'completed'),
+		       COUNT(*) FILTER (WHERE m.status <> 'completed' AND m.due_date < CURRENT_DATE)
+		FROM milestones m JOIN goals g ON g.id = m.goal_id
+		WHERE g.application_id = $1
+	`, applicationID).Scan(&summary.Milestones, &summary.MilestonesCompleted, &summary.MilestonesOverdue)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Progress is measured on milestones when there are any, otherwise on goals
+	if summary.Milestones > 0 {
+		summary.PercentComplete = 100 * float64(summary.MilestonesCompleted) / float64(summary.Milestones)
+	} else if summary.Goals > 0 {
+		summary.PercentComplete = 100 * float64(summary.GoalsCompleted) / float64(summary.Goals)
+	}
+
+	next, err := scanMilestone(db.QueryRow(`
+		SELECT m.id, m.goal_id, m.title, m.description, to_char(m.due_date, 'YYYY-MM-DD'), m.status, m.evidence_links,
+		       m.intern_note, m.completed_at, m.updated_at
+		FROM milestones m JOIN goals g ON g.id = m.goal_id
+		WHERE g.application_id = $1 AND m.status <> 'completed' AND m.due_date IS NOT NULL
+		ORDER BY m.due_date, m.id
+		LIMIT 1
+	`, applicationID))
+	if err == nil {
+		summary.NextDue = &next
+	} else if err != sql.ErrNoRows {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, summary)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Admins can impersonate a user to see exactly what they see. The impersonation
+// token is a regular token for the user with the admin in the impersonator_id
+// claim; it is short-lived and cannot be extended. Requests made with it are
+// audited under both identities, and deletions and credential changes are refused.
+
+const impersonationTTL = 30 * time.Minute
+
+// impersonationBlocked are routes refused while impersonating, besides every
+// DELETE request.
+var impersonationBlocked = map[string]bool{
+	"/api/calendar-feed/reset":      true,
+	"/api/users/:id/password-reset": true,
+	"/api/users/:id/impersonate":    true,
+}
+
+// impersonatorID returns the admin impersonating the authenticated user, or 0.
+func impersonatorID(c *gin.Context) int {
+	return c.GetInt("impersonator_id")
+}
+
+// impersonatorActive reports whether the admin behind an impersonation token may
+// still impersonate.
+func impersonatorActive(id int) bool {
+	var active bool
+	err := db.QueryRow(`
+		SELECT role = 'admin' AND suspended_at IS NULL FROM users WHERE id = $1 AND deleted_at IS NULL
+	`, id).Scan(&active)
+	return err == nil && active
+}
+
+// impersonateUser issues a token acting as the user in the path. Admins cannot be
+// impersonated, nor can suspended users.
+func impersonateUser(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+	if id == currentUserID(c) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot impersonate yourself"})
+		return
+	}
+
+	user, err := scanUser(db.QueryRow(userSelect+" WHERE id = $1 AND deleted_at IS NULL", id))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if user.Role == "admin" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Admins cannot be impersonated"})
+		return
+	}
+	if user.SuspendedAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Suspended users cannot be impersonated"})
+		return
+	}
+
+	var tokenVersion int
+	if err := db.QueryRow("SELECT token_version FROM users WHERE id = $1", id).Scan(&tokenVersion); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	expiresAt := time.Now().Add(impersonationTTL)
+	claims := jwt.MapClaims{
+		"user_id":         user.ID,
+		"email":           user.Email,
+		"role":            user.Role,
+		"token_version":   tokenVersion,
+		"impersonator_id": currentUserID(c),
+		"exp":             expiresAt.Unix(),
+	}
+	if user.OrganizationID != nil {
+		claims["organization_id"] = *user.OrganizationID
+	}
+	tokenString, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(jwtSecret)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"token":           tokenString,
+		"user":            user,
+		"impersonator_id": currentUserID(c),
+		"expires_at":      expiresAt.UTC(),
+	})
+}
+
+// impersonationGuard refuses blocked requests made with an impersonation token and
+// audits the reads, which audit does not cover.
+func impersonationGuard() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if impersonatorID(c) == 0 {
+			c.Next()
+			return
+		}
+		if c.Request.Method == http.MethodDelete || impersonationBlocked[c.FullPath()] {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Not allowed while impersonating"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+
+		if c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+			return
+		}
+		if err := recordAudit(db, newAuditEntry(c, "impersonation.view", "impersonation")); err != nil {
+			log.Printf("Error recording audit entry for impersonation.view: %v", err)
+		}
+	}
+}
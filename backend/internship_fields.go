@@ -0,0 +1,412 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Internships keep the free-text duration, location and salary shown in listings,
+// alongside structured fields used for filtering and sorting. Structured fields
+// missing from a request are parsed from the text, and text missing from a request
+// is formatted from the structured fields.
+
+var salaryPeriods = []string{"hour", "week", "month", "year", "total"}
+
+var (
+	durationPattern = regexp.MustCompile(`(\d+(?:\.\d+)?)\s*(?:(?:-|–|to)\s*\d+(?:\.\d+)?\s*)?(days?|weeks?|wks?|months?|mos?|years?|yrs?)\b`)
+	amountPattern   = regexp.MustCompile(`(\d[\d,]*(?:\.\d+)?)\s*(k\b)?(?:\s*(?:-|–|to)\s*\D{0,3}?(\d[\d,]*(?:\.\d+)?)\s*(k\b)?)?`)
+	currencyPattern = regexp.MustCompile(`\b(usd|eur|gbp|inr|cad|aud|chf|jpy|sgd)\b`)
+	hybridPattern   = regexp.MustCompile(`(?i)[(\[]?\bhybrid\b[)\]]?\s*[-–:|]?`)
+	periodPatterns  = []struct {
+		period  string
+		pattern *regexp.Regexp
+	}{
+		{"hour", regexp.MustCompile(`\b(hour|hourly|hr|h)\b`)},
+		{"week", regexp.MustCompile(`\b(week|weekly|wk)\b`)},
+		{"month", regexp.MustCompile(`\b(month|monthly|mo)\b`)},
+		{"year", regexp.MustCompile(`\b(year|yearly|yr|annum|annual|annually)\b`)},
+		{"total", regexp.MustCompile(`\b(total|stipend|lump sum)\b`)},
+	}
+)
+
+var currencySymbols = map[string]string{"$": "USD", "€": "EUR", "£": "GBP", "₹": "INR", "¥": "JPY"}
+
+// countryCodes maps country names and codes to ISO 3166 alpha-2 codes.
+var countryCodes = map[string]string{
+	"us": "US", "usa": "US", "united states": "US", "united states of america": "US",
+	"uk": "GB", "gb": "GB", "united kingdom": "GB", "great britain": "GB", "england": "GB",
+	"canada": "CA", "ca": "CA", "germany": "DE", "de": "DE", "france": "FR", "fr": "FR",
+	"india": "IN", "in": "IN", "netherlands": "NL", "nl": "NL", "spain": "ES", "es": "ES",
+	"italy": "IT", "it": "IT", "australia": "AU", "au": "AU", "singapore": "SG", "sg": "SG",
+	"ireland": "IE", "ie": "IE", "japan": "JP", "jp": "JP", "china": "CN", "cn": "CN",
+	"brazil": "BR", "br": "BR", "mexico": "MX", "mx": "MX", "sweden": "SE", "se": "SE",
+	"switzerland": "CH", "ch": "CH",
+}
+
+var usStates = map[string]bool{
+	"AL": true, "AK": true, "AZ": true, "AR": true, "CA": true, "CO": true, "CT": true, "DE": true,
+	"FL": true, "GA": true, "HI": true, "ID": true, "IL": true, "IN": true, "IA": true, "KS": true,
+	"KY": true, "LA": true, "ME": true, "MD": true, "MA": true, "MI": true, "MN": true, "MS": true,
+	"MO": true, "MT": true, "NE": true, "NV": true, "NH": true, "NJ": true, "NM": true, "NY": true,
+	"NC": true, "ND": true, "OH": true, "OK": true, "OR": true, "PA": true, "RI": true, "SC": true,
+	"SD": true, "TN": true, "TX": true, "UT": true, "VT": true, "VA": true, "WA": true, "WV": true,
+	"WI": true, "WY": true, "DC": true,
+}
+
+// countryCode normalizes a country name or code, reporting whether it is known.
+func countryCode(s string) (string, bool) {
+	code, ok := countryCodes[strings.ToLower(strings.TrimSpace(s))]
+	return code, ok
+}
+
+// isCountryCode reports whether s is a two-letter code of a known country.
+func isCountryCode(s string) bool {
+	code, ok := countryCode(s)
+	return ok && strings.EqualFold(code, s)
+}
+
+// knownUSCity reports whether the geocoder table has the city in the US state.
+func knownUSCity(city, state string) bool {
+	for _, p := range geocoderPlaces {
+		if p.Country == "US" && strings.EqualFold(p.City, city) && strings.EqualFold(p.Region, state) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseDuration reads durations like "3 months" or "10-12 weeks" as weeks, using
+// the lower bound of ranges.
+func parseDuration(s string) *int {
+	m := durationPattern.FindStringSubmatch(strings.ToLower(s))
+	if m == nil {
+		return nil
+	}
+	n, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return nil
+	}
+	switch unit := strings.TrimSuffix(m[2], "s"); unit {
+	case "day":
+		n /= 7
+	case "month", "mo":
+		n *= 52.0 / 12
+	case "year", "yr":
+		n *= 52
+	}
+	weeks := int(math.Round(n))
+	if weeks < 1 {
+		weeks = 1
+	}
+	return &weeks
+}
+
+// parseLocation splits locations like "San Francisco, CA" or "Berlin, Germany" into
+// city, region and country. Remote locations, like "Remote (US)", have none, and
+// hybrid ones, like "Berlin, Germany (Hybrid)", are read without the marker. Codes
+// that are both a US state and a country, like CA or DE, are read as the country
+// unless the city is a known US city in that state.
+func parseLocation(s string) (city, region, country *string) {
+	var parts []string
+	for _, part := range strings.Split(hybridPattern.ReplaceAllString(s, ""), ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	if len(parts) == 0 || contains([]string{"remote", "anywhere", "online", "worldwide"}, strings.ToLower(strings.Fields(parts[0])[0])) {
+		return nil, nil, nil
+	}
+
+	first, last := parts[0], parts[len(parts)-1]
+	switch {
+	case len(parts) == 1:
+		if code, ok := countryCode(first); ok {
+			return nil, nil, &code
+		}
+		return &first, nil, nil
+	case len(parts) == 2 && usStates[strings.ToUpper(last)] && (!isCountryCode(last) || knownUSCity(first, last)):
+		state, us := strings.ToUpper(last), "US"
+		return &first, &state, &us
+	case len(parts) == 2:
+		if code, ok := countryCode(last); ok {
+			return &first, nil, &code
+		}
+		return &first, &last, nil
+	}
+	middle := strings.Join(parts[1:len(parts)-1], ", ")
+	if code, ok := countryCode(last); ok {
+		last = code
+	}
+	return &first, &middle, &last
+}
+
+// parseSalary reads salaries like "$2000/month", "€1,500 - 2,000 per month" or
+// "20 USD/hr". A single amount is both the minimum and the maximum.
+func parseSalary(s string) (min, max *float64, currency, period *string) {
+	text := strings.ToLower(s)
+	if strings.Contains(text, "unpaid") || strings.Contains(text, "volunteer") {
+		zero := 0.0
+		return &zero, &zero, nil, nil
+	}
+
+	m := amountPattern.FindStringSubmatch(text)
+	if m == nil {
+		return nil, nil, nil, nil
+	}
+	parse := func(number, thousands string) *float64 {
+		v, err := strconv.ParseFloat(strings.ReplaceAll(number, ",", ""), 64)
+		if err != nil {
+			return nil
+		}
+		if thousands != "" {
+			v *= 1000
+		}
+		return &v
+	}
+	min = parse(m[1], m[2])
+	max = min
+	if m[3] != "" {
+		// "20-30k" applies the k to both ends
+		thousands := m[4]
+		if thousands == "" {
+			thousands = m[2]
+		}
+		if m[2] == "" && m[4] != "" {
+			min = parse(m[1], m[4])
+		}
+		max = parse(m[3], thousands)
+	}
+	if min == nil || max == nil {
+		return nil, nil, nil, nil
+	}
+	if *max < *min {
+		min, max = max, min
+	}
+
+	for symbol, code := range currencySymbols {
+		if strings.Contains(text, symbol) {
+			code := code
+			currency = &code
+		}
+	}
+	if m := currencyPattern.FindString(text); m != "" {
+		code := strings.ToUpper(m)
+		currency = &code
+	}
+	for _, p := range periodPatterns {
+		if p.pattern.MatchString(text) {
+			value := p.period
+			period = &value
+			break
+		}
+	}
+	return min, max, currency, period
+}
+
+func formatDuration(weeks int) string {
+	if weeks == 1 {
+		return "1 week"
+	}
+	return fmt.Sprintf("%d weeks", weeks)
+}
+
+func formatLocation(city, region, country *string) string {
+	var parts []string
+	for _, part := range []*string{city, region, country} {
+		if part != nil && *part != "" {
+			parts = append(parts, *part)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+func formatSalary(min, max *float64, currency, period *string) string {
+	amount := func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
+	var s string
+	switch {
+	case min != nil && max != nil && *min != *max:
+		s = amount(*min) + "-" + amount(*max)
+	case min != nil:
+		s = amount(*min)
+	case max != nil:
+		s = amount(*max)
+	default:
+		return ""
+	}
+	if min != nil && max != nil && *min == 0 && *max == 0 {
+		return "Unpaid"
+	}
+	if currency != nil {
+		prefixed := false
+		for symbol, code := range currencySymbols {
+			if code == *currency {
+				s, prefixed = symbol+s, true
+				break
+			}
+		}
+		if !prefixed {
+			s += " " + *currency
+		}
+	}
+	if period != nil && *period != "total" {
+		s += "/" + *period
+	}
+	return s
+}
+
+// normalizeInternshipFields fills in whichever of the text and structured fields the
+// request left out, and validates the structured fields.
+func normalizeInternshipFields(internship *Internship) error {
+	if internship.DurationWeeks == nil {
+		internship.DurationWeeks = parseDuration(internship.Duration)
+	} else if internship.Duration == "" {
+		internship.Duration = formatDuration(*internship.DurationWeeks)
+	}
+
+	if internship.City == nil && internship.Region == nil && internship.Country == nil {
+		internship.City, internship.Region, internship.Country = parseLocation(internship.Location)
+	} else if internship.Location == "" {
+		internship.Location = formatLocation(internship.City, internship.Region, internship.Country)
+	}
+	if internship.Country != nil {
+		if code, ok := countryCode(*internship.Country); ok {
+			internship.Country = &code
+		}
+	}
+
+	if internship.SalaryMin == nil && internship.SalaryMax == nil && internship.Salary != nil {
+		internship.SalaryMin, internship.SalaryMax, internship.SalaryCurrency, internship.SalaryPeriod = parseSalary(*internship.Salary)
+	} else if internship.Salary == nil || *internship.Salary == "" {
+		if s := formatSalary(internship.SalaryMin, internship.SalaryMax, internship.SalaryCurrency, internship.SalaryPeriod); s != "" {
+			internship.Salary = &s
+		}
+	}
+	if internship.SalaryCurrency != nil {
+		code := strings.ToUpper(*internship.SalaryCurrency)
+		internship.SalaryCurrency = &code
+	}
+
+	if internship.DurationWeeks != nil && *internship.DurationWeeks < 1 {
+		return fmt.Errorf("duration_weeks must be at least 1")
+	}
+	if (internship.Latitude == nil) != (internship.Longitude == nil) {
+		return fmt.Errorf("latitude and longitude must be given together")
+	}
+	if internship.Latitude != nil && (math.Abs(*internship.Latitude) > 90 || math.Abs(*internship.Longitude) > 180) {
+		return fmt.Errorf("latitude or longitude out of range")
+	}
+	if internship.SalaryMin != nil && internship.SalaryMax != nil && *internship.SalaryMax < *internship.SalaryMin {
+		return fmt.Errorf("salary_max must not be less than salary_min")
+	}
+	if (internship.SalaryMin != nil && *internship.SalaryMin < 0) || (internship.SalaryMax != nil && *internship.SalaryMax < 0) {
+		return fmt.Errorf("salary must not be negative")
+	}
+	if internship.SalaryCurrency != nil && len(*internship.SalaryCurrency) != 3 {
+		return fmt.Errorf("salary_currency must be a three-letter currency code")
+	}
+	if internship.SalaryPeriod != nil && !contains(salaryPeriods, *internship.SalaryPeriod) {
+		return fmt.Errorf("salary_period must be one of: %s", strings.Join(salaryPeriods, ", "))
+	}
+	return nil
+}
+
+// reconcileInternshipFields prepares an update of the stored internship. Clients
+// often send back every field they read, so a request that changes a text field
+// but echoes its stored structured fields has them parsed again from the new text,
+// and one that changes only the structured fields has the text formatted again.
+// When both change, the request is taken as given.
+func reconcileInternshipFields(internship *Internship, stored Internship) {
+	if internship.Country != nil {
+		if code, ok := countryCode(*internship.Country); ok {
+			internship.Country = &code
+		}
+	}
+	if internship.SalaryCurrency != nil {
+		code := strings.ToUpper(*internship.SalaryCurrency)
+		internship.SalaryCurrency = &code
+	}
+
+	durationChanged := internship.Duration != stored.Duration
+	weeksEchoed := samePtr(internship.DurationWeeks, stored.DurationWeeks)
+	if durationChanged && weeksEchoed {
+		internship.DurationWeeks = nil
+	} else if !durationChanged && !weeksEchoed && internship.DurationWeeks != nil {
+		internship.Duration = ""
+	}
+
+	locationChanged := internship.Location != stored.Location
+	placeEchoed := samePtr(internship.City, stored.City) && samePtr(internship.Region, stored.Region) &&
+		samePtr(internship.Country, stored.Country)
+	placeGiven := internship.City != nil || internship.Region != nil || internship.Country != nil
+	if locationChanged && placeEchoed {
+		internship.City, internship.Region, internship.Country = nil, nil, nil
+	} else if !locationChanged && !placeEchoed && placeGiven {
+		internship.Location = ""
+	}
+
+	salaryChanged := derefOr(internship.Salary) != derefOr(stored.Salary)
+	amountEchoed := samePtr(internship.SalaryMin, stored.SalaryMin) && samePtr(internship.SalaryMax, stored.SalaryMax) &&
+		samePtr(internship.SalaryCurrency, stored.SalaryCurrency) && samePtr(internship.SalaryPeriod, stored.SalaryPeriod)
+	amountGiven := internship.SalaryMin != nil || internship.SalaryMax != nil
+	if salaryChanged && amountEchoed {
+		internship.SalaryMin, internship.SalaryMax, internship.SalaryCurrency, internship.SalaryPeriod = nil, nil, nil, nil
+	} else if !salaryChanged && !amountEchoed && amountGiven {
+		internship.Salary = nil
+	}
+}
+
+// samePtr reports whether two optional values are both empty or both equal.
+func samePtr[T comparable](a, b *T) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func derefOr(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// migrateInternshipFields parses the text fields of internships created before the
+// structured fields existed. Text that cannot be parsed leaves the fields empty.
+func migrateInternshipFields() error {
+	rows, err := db.Query(`
+		SELECT id, duration, location, salary FROM internships
+		WHERE duration_weeks IS NULL AND city IS NULL AND region IS NULL AND country IS NULL
+		  AND salary_min IS NULL AND salary_max IS NULL
+	`)
+	if err != nil {
+		return err
+	}
+	var internships []Internship
+	for rows.Next() {
+		var internship Internship
+		if err := rows.Scan(&internship.ID, &internship.Duration, &internship.Location, &internship.Salary); err != nil {
+			continue
+		}
+		internships = append(internships, internship)
+	}
+	rows.Close()
+
+	for _, internship := range internships {
+		if err := normalizeInternshipFields(&internship); err != nil {
+			continue
+		}
+		_, err := db.Exec(`
+			UPDATE internships SET duration_weeks = $1, city = $2, region = $3, country = $4,
+			       salary_min = $5, salary_max = $6, salary_currency = $7, salary_period = $8
+			WHERE id = $9
+		`, internship.DurationWeeks, internship.City, internship.Region, internship.Country,
+			internship.SalaryMin, internship.SalaryMax, internship.SalaryCurrency, internship.SalaryPeriod, internship.ID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import "testing"
+
+func ptrString(p *string) string {
+	if p == nil {
+		return "<nil>"
+	}
+	return *p
+}
+
+func TestParseSalary(t *testing.T) {
+	tests := []struct {
+		in       string
+		min, max float64
+		currency string
+		period   string
+	}{
+		{"$2000/month", 2000, 2000, "USD", "month"},
+		{"€1,500 - 2,000 per month", 1500, 2000, "EUR", "month"},
+		{"20 USD/hr", 20, 20, "USD", "hour"},
+		{"$25 per hour", 25, 25, "USD", "hour"},
+		{"£300 weekly", 300, 300, "GBP", "week"},
+		{"20-30k EUR per year", 20000, 30000, "EUR", "year"},
+		{"$20k-30k", 20000, 30000, "USD", "<nil>"},
+		{"30k - 40k", 30000, 40000, "<nil>", "<nil>"},
+		{"1500 - 1200 CHF monthly", 1200, 1500, "CHF", "month"},
+		{"₹15,000 stipend", 15000, 15000, "INR", "total"},
+		{"Unpaid", 0, 0, "<nil>", "<nil>"},
+		{"Volunteer position", 0, 0, "<nil>", "<nil>"},
+	}
+	for _, tt := range tests {
+		min, max, currency, period := parseSalary(tt.in)
+		if min == nil || max == nil {
+			t.Errorf("parseSalary(%q) = no amount, want %v-%v", tt.in, tt.min, tt.max)
+			continue
+		}
+		if *min != tt.min || *max != tt.max || ptrString(currency) != tt.currency || ptrString(period) != tt.period {
+			t.Errorf("parseSalary(%q) = %v-%v %s/%s, want %v-%v %s/%s", tt.in,
+				*min, *max, ptrString(currency), ptrString(period), tt.min, tt.max, tt.currency, tt.period)
+		}
+	}
+
+	for _, in := range []string{"", "Competitive", "Negotiable"} {
+		if min, max, _, _ := parseSalary(in); min != nil || max != nil {
+			t.Errorf("parseSalary(%q) = %v-%v, want no amount", in, *min, *max)
+		}
+	}
+}
+
+func TestParseLocation(t *testing.T) {
+	tests := []struct {
+		in                    string
+		city, region, country string
+	}{
+		{"San Francisco, CA", "San Francisco", "CA", "US"},
+		{"Austin, TX, USA", "Austin", "TX", "US"},
+		{"Berlin, Germany", "Berlin", "<nil>", "DE"},
+		{"Berlin, DE", "Berlin", "<nil>", "DE"},
+		{"Wilmington, DE", "Wilmington", "DE", "US"},
+		{"Toronto, CA", "Toronto", "<nil>", "CA"},
+		{"Toronto, Ontario, Canada", "Toronto", "Ontario", "CA"},
+		{"Paris", "Paris", "<nil>", "<nil>"},
+		{"Germany", "<nil>", "<nil>", "DE"},
+		{"Hybrid - London, UK", "London", "<nil>", "GB"},
+		{"London, UK (Hybrid)", "London", "<nil>", "GB"},
+		{"Hybrid", "<nil>", "<nil>", "<nil>"},
+		{"Remote", "<nil>", "<nil>", "<nil>"},
+		{"Remote (US)", "<nil>", "<nil>", "<nil>"},
+		{"anywhere", "<nil>", "<nil>", "<nil>"},
+		{"", "<nil>", "<nil>", "<nil>"},
+	}
+	for _, tt := range tests {
+		city, region, country := parseLocation(tt.in)
+		if ptrString(city) != tt.city || ptrString(region) != tt.region || ptrString(country) != tt.country {
+			t.Errorf("parseLocation(%q) = %s / %s / %s, want %s / %s / %s", tt.in,
+				ptrString(city), ptrString(region), ptrString(country), tt.city, tt.region, tt.country)
+		}
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		in    string
+		weeks int
+	}{
+		{"12 weeks", 12},
+		{"6 wks", 6},
+		{"10-12 weeks", 10},
+		{"10 to 12 weeks", 10},
+		{"3 months", 13},
+		{"6 mos", 26},
+		{"4–6 months", 17},
+		{"1.5 months", 7},
+		{"1 year", 52},
+		{"14 days", 2},
+		{"2 days", 1},
+	}
+	for _, tt := range tests {
+		if got := parseDuration(tt.in); got == nil || *got != tt.weeks {
+			t.Errorf("parseDuration(%q) = %v, want %d", tt.in, got, tt.weeks)
+		}
+	}
+
+	for _, in := range []string{"", "Flexible", "Summer"} {
+		if got := parseDuration(in); got != nil {
+			t.Errorf("parseDuration(%q) = %d, want nil", in, *got)
+		}
+	}
+}
@@ -0,0 +1,456 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// Internship templates hold the parts of a posting that stay the same between
+// semesters. A template belongs to the mentor who saved it; shared templates are
+// also available to the other mentors of its company.
+
+type InternshipTemplate struct {
+	ID           int        `json:"id" db:"id"`
+	Name         string     `json:"name" db:"name"`
+	OwnerID      int        `json:"owner_id" db:"owner_id"`
+	Shared       bool       `json:"shared" db:"shared"`
+	Title        string     `json:"title" db:"title"`
+	Company      string     `json:"company" db:"company"`
+	CompanyID    *int       `json:"company_id" db:"company_id"`
+	Description  string     `json:"description" db:"description"`
+	Requirements []string   `json:"requirements" db:"requirements"`
+	Tags         []string   `json:"tags" db:"tags"`
+	Duration     string     `json:"duration" db:"duration"`
+	Salary       *string    `json:"salary" db:"salary"`
+	CreatedAt    time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt    *time.Time `json:"updated_at" db:"updated_at"`
+}
+
+type InternshipTemplateRequest struct {
+	Name         string   `json:"name" binding:"required"`
+	Shared       bool     `json:"shared"`
+	Title        string   `json:"title" binding:"required"`
+	Company      string   `json:"company"`
+	CompanyID    *int     `json:"company_id"`
+	Description  string   `json:"description"`
+	Requirements []string `json:"requirements"`
+	Tags         []string `json:"tags"`
+	Duration     string   `json:"duration"`
+	Salary       *string  `json:"salary"`
+}
+
+// InternshipCopyRequest holds the fields that change each time a posting is reused.
+type InternshipCopyRequest struct {
+	Deadline  *time.Time `json:"deadline" binding:"required"`
+	StartDate *string    `json:"start_date"`
+	EndDate   *string    `json:"end_date"`
+	Status    string     `json:"status"`
+	PublishAt *time.Time `json:"publish_at"`
+}
+
+// InternshipFromTemplateRequest completes a template into a posting. MentorID
+// defaults to the caller.
+type InternshipFromTemplateRequest struct {
+	InternshipCopyRequest
+	Location    string `json:"location" binding:"required"`
+	Type        string `json:"type" binding:"required"`
+	MaxStudents int    `json:"max_students"`
+	MentorID    int    `json:"mentor_id"`
+}
+
+// apply copies the request onto a new internship.
+func (r InternshipCopyRequest) apply(internship *Internship) {
+	internship.Deadline = *r.Deadline
+	internship.StartDate, internship.EndDate = r.StartDate, r.EndDate
+	internship.Status, internship.PublishAt = r.Status, r.PublishAt
+}
+
+const internshipTemplateSelect = `
+	SELECT t.id, t.name, t.owner_id, t.shared, t.title, t.company, t.company_id, t.description,
+	       t.requirements, t.tags, t.duration, t.salary, t.created_at, t.updated_at
+	FROM internship_templates t
+`
+
+// internshipTemplateVisible restricts templates to the caller's: their own and
+// their company's shared ones, or all templates of the tenant for admins. It takes
+// the tenant scope as $1, whether the caller is an admin as $2 and their ID as $3.
+const internshipTemplateVisible = `
+	($1 = 0 OR t.organization_id = $1)
+	AND ($2 OR t.owner_id = $3 OR (t.shared AND t.company_id = (SELECT company_id FROM users WHERE id = $3)))
+`
+
+func scanInternshipTemplate(row interface{ Scan(...interface{}) error }) (InternshipTemplate, error) {
+	var t InternshipTemplate
+	err := row.Scan(&t.ID, &t.Name, &t.OwnerID, &t.Shared, &t.Title, &t.Company, &t.CompanyID, &t.Description,
+		pq.Array(&t.Requirements), pq.Array(&t.Tags), &t.Duration, &t.Salary, &t.CreatedAt, &t.UpdatedAt)
+	return t, err
+}
+
+// loadInternshipTemplate reads a template visible to the caller, writing the error
+// response when there is none.
+func loadInternshipTemplate(c *gin.Context, q sqlQueryer, id int) (InternshipTemplate, bool) {
+	t, err := scanInternshipTemplate(q.QueryRow(
+		internshipTemplateSelect+" WHERE t.id = $4 AND "+internshipTemplateVisible,
+		tenantScope(c), isAdmin(c), currentUserID(c), id,
+	))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Template not found"})
+		return t, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return t, false
+	}
+	return t, true
+}
+
+// canManageInternshipTemplate allows the owner and admins to change a template, and
+// the company's mentors to change its shared templates.
+func canManageInternshipTemplate(c *gin.Context, t InternshipTemplate) (bool, error) {
+	if isAdmin(c) || t.OwnerID == currentUserID(c) {
+		return true, nil
+	}
+	if !t.Shared || t.CompanyID == nil {
+		return false, nil
+	}
+	return canManageCompany(c, *t.CompanyID)
+}
+
+// resolveTemplateCompany links the template's company like an internship's,
+// writing the error response when it cannot. current is the company the template
+// already has. Shared templates need a company to be shared with.
+func resolveTemplateCompany(c *gin.Context, q sqlQueryer, req *InternshipTemplateRequest, current *int) bool {
+	id, name, err := linkCompany(c, q, req.CompanyID, req.Company, current)
+	if err != nil {
+		companyError(c, err)
+		return false
+	}
+	req.Company, req.CompanyID = name, id
+	if req.Shared && req.CompanyID == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Shared templates need a company"})
+		return false
+	}
+	return true
+}
+
+func getInternshipTemplates(c *gin.Context) {
+	rows, err := db.Query(
+		internshipTemplateSelect+" WHERE "+internshipTemplateVisible+" ORDER BY t.name",
+		tenantScope(c), isAdmin(c), currentUserID(c),
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	templates := []InternshipTemplate{}
+	for rows.Next() {
+		t, err := scanInternshipTemplate(rows)
+		if err != nil {
+			continue
+		}
+		templates = append(templates, t)
+	}
+
+	c.JSON(http.StatusOK, templates)
+}
+
+func getInternshipTemplate(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+	if t, ok := loadInternshipTemplate(c, db, id); ok {
+		c.JSON(http.StatusOK, t)
+	}
+}
+
+func createInternshipTemplate(c *gin.Context) {
+	var req InternshipTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !resolveTemplateCompany(c, db, &req, nil) {
+		return
+	}
+
+	var id int
+	err := db.QueryRow(`
+		INSERT INTO internship_templates (name, owner_id, organization_id, shared, title, company, company_id,
+			description, requirements, tags, duration, salary)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12) RETURNING id
+	`, req.Name, currentUserID(c), currentOrganizationID(c), req.Shared, req.Title, req.Company, req.CompanyID,
+		req.Description, pq.Array(req.Requirements), pq.Array(req.Tags), req.Duration, req.Salary,
+	).Scan(&id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"id": id, "message": "Template created successfully"})
+}
+
+// createInternshipTemplateFrom saves an existing internship as a template. Its
+// company is checked like a new posting's, except for the internship's own mentor.
+func createInternshipTemplateFrom(c *gin.Context) {
+	internshipID, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+	var req struct {
+		Name   string `json:"name" binding:"required"`
+		Shared bool   `json:"shared"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var companyID *int
+	var mentorID int
+	err := db.QueryRow(
+		"SELECT company_id, mentor_id FROM internships WHERE id = $1 AND ($2 = 0 OR organization_id = $2)",
+		internshipID, tenantScope(c),
+	).Scan(&companyID, &mentorID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Internship not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Shared && companyID == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Shared templates need a company"})
+		return
+	}
+	if companyID != nil && mentorID != currentUserID(c) {
+		if _, _, err := linkCompany(c, db, companyID, "", nil); err != nil {
+			companyError(c, err)
+			return
+		}
+	}
+
+	var id int
+	err = db.QueryRow(`
+		INSERT INTO internship_templates (name, owner_id, organization_id, shared, title, company, company_id,
+			description, requirements, tags, duration, salary)
+		SELECT $1, $2, $3, $4, title, company, company_id, description, requirements, tags, duration, salary
+		FROM internships WHERE id = $5
+		RETURNING id
+	`, req.Name, currentUserID(c), currentOrganizationID(c), req.Shared, internshipID).Scan(&id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"id": id, "message": "Template created successfully"})
+}
+
+func updateInternshipTemplate(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+	var req InternshipTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	t, ok := loadInternshipTemplate(c, db, id)
+	if !ok {
+		return
+	}
+	if allowed, err := canManageInternshipTemplate(c, t); err != nil || !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Not allowed to change this template"})
+		return
+	}
+	if !resolveTemplateCompany(c, db, &req, t.CompanyID) {
+		return
+	}
+
+	_, err := db.Exec(`
+		UPDATE internship_templates SET name = $1, shared = $2, title = $3, company = $4, company_id = $5,
+			description = $6, requirements = $7, tags = $8, duration = $9, salary = $10, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $11
+	`, req.Name, req.Shared, req.Title, req.Company, req.CompanyID, req.Description,
+		pq.Array(req.Requirements), pq.Array(req.Tags), req.Duration, req.Salary, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Template updated successfully"})
+}
+
+func deleteInternshipTemplate(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+
+	t, ok := loadInternshipTemplate(c, db, id)
+	if !ok {
+		return
+	}
+	if allowed, err := canManageInternshipTemplate(c, t); err != nil || !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Not allowed to delete this template"})
+		return
+	}
+
+	if _, err := db.Exec("DELETE FROM internship_templates WHERE id = $1", id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Template deleted successfully"})
+}
+
+// instantiateInternshipTemplate creates an internship from a template and the
+// posting-specific fields of the request. Only the template's owner may post for its
+// company without working for it.
+func instantiateInternshipTemplate(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+	var req InternshipFromTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	t, ok := loadInternshipTemplate(c, tx, id)
+	if !ok {
+		return
+	}
+	if t.CompanyID != nil && t.OwnerID != currentUserID(c) {
+		if _, _, err := linkCompany(c, tx, t.CompanyID, "", nil); err != nil {
+			companyError(c, err)
+			return
+		}
+	}
+
+	internship := Internship{
+		Title:        t.Title,
+		Company:      t.Company,
+		CompanyID:    t.CompanyID,
+		Description:  t.Description,
+		Requirements: t.Requirements,
+		Tags:         t.Tags,
+		Duration:     t.Duration,
+		Salary:       t.Salary,
+		Location:     req.Location,
+		Type:         req.Type,
+		MaxStudents:  req.MaxStudents,
+		MentorID:     req.MentorID,
+	}
+	if internship.MaxStudents <= 0 {
+		internship.MaxStudents = 1
+	}
+	if internship.MentorID == 0 || currentUserRole(c) == "mentor" {
+		internship.MentorID = currentUserID(c)
+	}
+	req.apply(&internship)
+	if err := prepareNewInternship(&internship); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// The internship belongs to the mentor's organization, which must be the caller's
+	var organizationID int
+	err = tx.QueryRow(
+		"SELECT name, organization_id FROM users WHERE id = $1 AND role = 'mentor' AND ($2 = 0 OR organization_id = $2)",
+		internship.MentorID, tenantScope(c),
+	).Scan(&internship.MentorName, &organizationID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Mentor not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	internship.OrganizationID = &organizationID
+
+	if err := insertInternship(tx, currentUserID(c), &internship); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"id": internship.ID, "message": "Internship created successfully"})
+}
+
+// duplicateInternship reposts an internship with a new deadline and dates. Everything
+// else, including the mentor, is copied.
+func duplicateInternship(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+	var req InternshipCopyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	internship, err := scanInternship(tx.QueryRow(
+		internshipSelect+" WHERE i.id = $1 AND ($2 = 0 OR i.organization_id = $2) GROUP BY i.id",
+		id, tenantScope(c),
+	))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Internship not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if currentUserRole(c) == "mentor" && internship.MentorID != currentUserID(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the internship's mentor can duplicate it"})
+		return
+	}
+
+	req.apply(&internship)
+	if err := prepareNewInternship(&internship); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := insertInternship(tx, currentUserID(c), &internship); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"id": internship.ID, "message": "Internship duplicated successfully"})
+}
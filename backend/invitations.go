@@ -0,0 +1,326 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Only students register on their own. Mentors and admins join through an
+// invitation, which fixes their role, organization, company and department. Admins
+// and org admins invite any role they could assign; mentors invite colleagues to
+// their own company. Invitations are bound to an email address, expire, and can be
+// revoked until they are accepted.
+
+const (
+	defaultInvitationDays = 7
+	maxInvitationDays     = 30
+)
+
+type Invitation struct {
+	ID             int        `json:"id" db:"id"`
+	Email          string     `json:"email" db:"email"`
+	Role           string     `json:"role" db:"role"`
+	CompanyID      *int       `json:"company_id" db:"company_id"`
+	Company        *string    `json:"company"`
+	Department     *string    `json:"department" db:"department"`
+	OrganizationID int        `json:"organization_id" db:"organization_id"`
+	InvitedBy      *int       `json:"invited_by" db:"invited_by"`
+	Status         string     `json:"status"`
+	ExpiresAt      time.Time  `json:"expires_at" db:"expires_at"`
+	AcceptedAt     *time.Time `json:"accepted_at" db:"accepted_at"`
+	AcceptedUserID *int       `json:"accepted_user_id" db:"accepted_user_id"`
+	RevokedAt      *time.Time `json:"revoked_at" db:"revoked_at"`
+	CreatedAt      time.Time  `json:"created_at" db:"created_at"`
+}
+
+type InvitationRequest struct {
+	Email      string  `json:"email" binding:"required"`
+	Role       string  `json:"role" binding:"required"`
+	CompanyID  *int    `json:"company_id"`
+	Department *string `json:"department"`
+	// ExpiresInDays defaults to 7, at most 30
+	ExpiresInDays int `json:"expires_in_days"`
+}
+
+// invitationStatus derives pending, accepted, revoked or expired; $1 is the
+// current time in UTC.
+const invitationStatus = `
+	CASE WHEN v.accepted_at IS NOT NULL THEN 'accepted'
+	     WHEN v.revoked_at IS NOT NULL THEN 'revoked'
+	     WHEN v.expires_at <= $1 THEN 'expired'
+	     ELSE 'pending' END
+`
+
+const invitationSelect = `
+	SELECT v.id, v.email, v.role, v.company_id, co.name, v.department, v.organization_id, v.invited_by,
+	       ` + invitationStatus + `, v.expires_at, v.accepted_at, v.accepted_user_id, v.revoked_at, v.created_at
+	FROM invitations v
+	LEFT JOIN companies co ON co.id = v.company_id
+`
+
+func scanInvitation(row interface{ Scan(...interface{}) error }) (Invitation, error) {
+	var v Invitation
+	err := row.Scan(&v.ID, &v.Email, &v.Role, &v.CompanyID, &v.Company, &v.Department, &v.OrganizationID,
+		&v.InvitedBy, &v.Status, &v.ExpiresAt, &v.AcceptedAt, &v.AcceptedUserID, &v.RevokedAt, &v.CreatedAt)
+	return v, err
+}
+
+// invitationVisible restricts invitations to the caller's tenant, and for mentors
+// to those they sent. It takes the tenant scope as $2, whether the caller is an
+// admin as $3 and their ID as $4.
+const invitationVisible = `
+	($2 = 0 OR v.organization_id = $2) AND ($3 OR v.invited_by = $4)
+`
+
+func getInvitations(c *gin.Context) {
+	rows, err := db.Query(
+		invitationSelect+" WHERE "+invitationVisible+`
+			AND ($5 = '' OR `+invitationStatus+` = $5)
+		ORDER BY v.created_at DESC`,
+		time.Now().UTC(), tenantScope(c), isAdmin(c), currentUserID(c), c.Query("status"),
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	invitations := []Invitation{}
+	for rows.Next() {
+		v, err := scanInvitation(rows)
+		if err != nil {
+			continue
+		}
+		invitations = append(invitations, v)
+	}
+
+	c.JSON(http.StatusOK, invitations)
+}
+
+// validateInvitationRequest checks the role and company the caller may assign.
+// Mentors invite to their own company, which is filled in when omitted.
+func validateInvitationRequest(c *gin.Context, req *InvitationRequest) (int, string) {
+	address, err := mail.ParseAddress(strings.TrimSpace(req.Email))
+	if err != nil {
+		return http.StatusBadRequest, "Invalid email"
+	}
+	req.Email = strings.ToLower(address.Address)
+	if req.ExpiresInDays == 0 {
+		req.ExpiresInDays = defaultInvitationDays
+	}
+	if req.ExpiresInDays < 1 || req.ExpiresInDays > maxInvitationDays {
+		return http.StatusBadRequest, fmt.Sprintf("expires_in_days must be between 1 and %d", maxInvitationDays)
+	}
+	if roles := assignableRoles(c); !contains(roles, req.Role) {
+		return http.StatusForbidden, fmt.Sprintf("role must be one of: %s", strings.Join(roles, ", "))
+	}
+
+	if !isAdmin(c) {
+		var companyID sql.NullInt64
+		if err := db.QueryRow("SELECT company_id FROM users WHERE id = $1", currentUserID(c)).Scan(&companyID); err != nil {
+			return http.StatusInternalServerError, err.Error()
+		}
+		if !companyID.Valid {
+			return http.StatusForbidden, "Only mentors of a company can invite colleagues"
+		}
+		if req.CompanyID == nil {
+			id := int(companyID.Int64)
+			req.CompanyID = &id
+		}
+	}
+	if req.CompanyID != nil {
+		// Invitees can manage their company, so org admins get no exception here
+		allowed, err := canManageCompany(c, *req.CompanyID)
+		if err != nil {
+			return http.StatusInternalServerError, err.Error()
+		}
+		if !allowed {
+			return http.StatusForbidden, "Not allowed to invite to this company"
+		}
+		var found bool
+		if err := db.QueryRow("SELECT EXISTS (SELECT 1 FROM companies WHERE id = $1)", *req.CompanyID).Scan(&found); err != nil {
+			return http.StatusInternalServerError, err.Error()
+		}
+		if !found {
+			return http.StatusBadRequest, "Company not found"
+		}
+	}
+	return 0, ""
+}
+
+// createInvitation emails an invitation link, replacing any pending invitation of
+// the same address in the organization.
+func createInvitation(c *gin.Context) {
+	var req InvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if status, msg := validateInvitationRequest(c, &req); status != 0 {
+		c.JSON(status, gin.H{"error": msg})
+		return
+	}
+	organizationID, ok := targetOrganization(c)
+	if !ok {
+		return
+	}
+
+	var registered bool
+	if err := db.QueryRow("SELECT EXISTS (SELECT 1 FROM users WHERE lower(email) = $1)", req.Email).Scan(&registered); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if registered {
+		c.JSON(http.StatusConflict, gin.H{"error": "Email already registered"})
+		return
+	}
+
+	token, err := generateSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	expiresAt := time.Now().UTC().AddDate(0, 0, req.ExpiresInDays)
+	link := appURL() + "/register?invitation=" + url.QueryEscape(token)
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		UPDATE invitations SET revoked_at = CURRENT_TIMESTAMP
+		WHERE email = $1 AND organization_id = $2 AND accepted_at IS NULL AND revoked_at IS NULL
+	`, req.Email, organizationID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var id int
+	err = tx.QueryRow(`
+		INSERT INTO invitations (token_hash, email, role, company_id, department, organization_id, invited_by, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id
+	`, hashToken(token), req.Email, req.Role, req.CompanyID, req.Department, organizationID, currentUserID(c), expiresAt,
+	).Scan(&id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var inviter, organization string
+	err = tx.QueryRow(`
+		SELECT u.name, o.name FROM users u, organizations o WHERE u.id = $1 AND o.id = $2
+	`, currentUserID(c), organizationID).Scan(&inviter, &organization)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	err = enqueueEmail(tx, nil, req.Email, "", "invitation.created", "You are invited to join "+organization,
+		map[string]interface{}{
+			"inviter":      inviter,
+			"organization": organization,
+			"role":         req.Role,
+			"url":          link,
+			"expires_on":   expiresAt.Format("January 2, 2006"),
+		})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"id":         id,
+		"url":        link,
+		"expires_at": expiresAt,
+		"message":    "Invitation sent",
+	})
+}
+
+// revokeInvitation cancels a pending invitation.
+func revokeInvitation(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+
+	v, err := scanInvitation(db.QueryRow(
+		invitationSelect+" WHERE "+invitationVisible+" AND v.id = $5",
+		time.Now().UTC(), tenantScope(c), isAdmin(c), currentUserID(c), id,
+	))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invitation not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if v.Status != "pending" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Invitation is already " + v.Status})
+		return
+	}
+
+	if _, err := db.Exec("UPDATE invitations SET revoked_at = CURRENT_TIMESTAMP WHERE id = $1", id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Invitation revoked"})
+}
+
+// pendingInvitation reads the pending invitation with the token, locking it when
+// q is a transaction.
+func pendingInvitation(q sqlQueryer, token string, lock bool) (Invitation, error) {
+	query := invitationSelect + " WHERE v.token_hash = $2"
+	if lock {
+		query += " FOR UPDATE OF v"
+	}
+	v, err := scanInvitation(q.QueryRow(query, time.Now().UTC(), hashToken(token)))
+	if err == nil && v.Status != "pending" {
+		err = fmt.Errorf("invitation is %s", v.Status)
+	}
+	if err == sql.ErrNoRows {
+		err = fmt.Errorf("invitation not found")
+	}
+	return v, err
+}
+
+// getInvitationByToken lets the registration form show what an invitation grants.
+// The route is public; the token authenticates the request.
+func getInvitationByToken(c *gin.Context) {
+	v, err := pendingInvitation(db, c.Param("token"), false)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invitation not found or no longer valid"})
+		return
+	}
+
+	var organization string
+	if err := db.QueryRow("SELECT name FROM organizations WHERE id = $1", v.OrganizationID).Scan(&organization); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"email":        v.Email,
+		"role":         v.Role,
+		"company":      v.Company,
+		"department":   v.Department,
+		"organization": organization,
+		"expires_at":   v.ExpiresAt,
+	})
+}
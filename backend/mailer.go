@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"mime"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// EmailMessage is a rendered email ready for delivery.
+type EmailMessage struct {
+	To       string
+	Subject  string
+	HTMLBody string
+}
+
+// Mailer delivers rendered emails.
+type Mailer interface {
+	Send(msg EmailMessage) error
+}
+
+// SMTPMailer delivers emails through an SMTP relay.
+type SMTPMailer struct {
+	Addr     string
+	Host     string
+	Username string
+	Password string
+	From     string
+}
+
+func (m *SMTPMailer) Send(msg EmailMessage) error {
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+	return smtp.SendMail(m.Addr, auth, m.From, []string{msg.To}, formatEmail(m.From, msg))
+}
+
+// FileMailer writes each email as an .eml file into Dir instead of sending it, for
+// local development.
+type FileMailer struct {
+	Dir  string
+	From string
+}
+
+func (m *FileMailer) Send(msg EmailMessage) error {
+	if err := os.MkdirAll(m.Dir, 0o755); err != nil {
+		return err
+	}
+
+	recipient := strings.NewReplacer("@", "_at_", "/", "_").Replace(msg.To)
+	name := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102-150405.000000"), recipient)
+	return os.WriteFile(filepath.Join(m.Dir, name), formatEmail(m.From, msg), 0o644)
+}
+
+// formatEmail builds an RFC 5322 message with an HTML body.
+func formatEmail(from string, msg EmailMessage) []byte {
+	var b strings.Builder
+	b.WriteString("From: " + from + "\r\n")
+	b.WriteString("To: " + msg.To + "\r\n")
+	b.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", msg.Subject) + "\r\n")
+	b.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/html; charset=\"utf-8\"\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(msg.HTMLBody)
+	return []byte(b.String())
+}
+
+// newMailer selects the mailer from MAILER ("file" or "smtp").
+func newMailer() Mailer {
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "LMS Internship Portal <no-reply@lms.local>"
+	}
+
+	if os.Getenv("MAILER") == "smtp" {
+		host := os.Getenv("SMTP_HOST")
+		port := os.Getenv("SMTP_PORT")
+		if port == "" {
+			port = "587"
+		}
+		log.Printf("Sending email through SMTP relay %s:%s", host, port)
+		return &SMTPMailer{
+			Addr:     host + ":" + port,
+			Host:     host,
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     from,
+		}
+	}
+
+	dir := os.Getenv("MAIL_DROP_DIR")
+	if dir == "" {
+		dir = "maildrop"
+	}
+	log.Printf("Writing emails to %s", dir)
+	return &FileMailer{Dir: dir, From: from}
+}
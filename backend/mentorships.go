@@ -0,0 +1,355 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+type Mentorship struct {
+	ID          int        `json:"id" db:"id"`
+	MentorID    int        `json:"mentor_id" db:"mentor_id"`
+	MentorName  string     `json:"mentor_name"`
+	StudentID   int        `json:"student_id" db:"student_id"`
+	StudentName string     `json:"student_name"`
+	Status      string     `json:"status" db:"status"`
+	Message     *string    `json:"message" db:"message"`
+	RequestedAt time.Time  `json:"requested_at" db:"requested_at"`
+	RespondedAt *time.Time `json:"responded_at" db:"responded_at"`
+	EndedAt     *time.Time `json:"ended_at" db:"ended_at"`
+	EndReason   *string    `json:"end_reason" db:"end_reason"`
+}
+
+type MentorProfile struct {
+	User
+	Capacity      int  `json:"capacity"`
+	ActiveMentees int  `json:"active_mentees"`
+	Available     bool `json:"available"`
+	MatchedSkills int  `json:"matched_skills"`
+}
+
+type MentorshipRequest struct {
+	MentorID int     `json:"mentor_id" binding:"required"`
+	Message  *string `json:"message"`
+}
+
+type EndMentorshipRequest struct {
+	Reason *string `json:"reason"`
+}
+
+type CapacityRequest struct {
+	Capacity int `json:"capacity" binding:"min=0"`
+}
+
+const mentorshipSelect = `
+	SELECT m.id, m.mentor_id, mu.name, m.student_id, su.name, m.status, m.message,
+	       m.requested_at, m.responded_at, m.ended_at, m.end_reason
+	FROM mentorships m
+	JOIN users mu ON mu.id = m.mentor_id
+	JOIN users su ON su.id = m.student_id
+`
+
+func scanMentorship(row interface{ Scan(...interface{}) error }) (Mentorship, error) {
+	var m Mentorship
+	err := row.Scan(&m.ID, &m.MentorID, &m.MentorName, &m.StudentID, &m.StudentName, &m.Status, &m.Message,
+		&m.RequestedAt, &m.RespondedAt, &m.EndedAt, &m.EndReason)
+	return m, err
+}
+
+// getMentors lets students discover mentors by skills and department. Mentors with
+// the most matching skills come first.
+func getMentors(c *gin.Context) {
+	var skills []string
+	for _, skill := range strings.Split(c.Query("skills"), ",") {
+		if skill = strings.TrimSpace(skill); skill != "" {
+			skills = append(skills, strings.ToLower(skill))
+		}
+	}
+
+	rows, err := db.Query(`
+		SELECT u.id, u.email, u.name, u.role, u.avatar, u.department, u.company, u.bio, u.skills, u.experience, u.created_at,
+		       u.mentorship_capacity,
+		       (SELECT COUNT(*) FROM mentorships m WHERE m.mentor_id = u.id AND m.status = 'active') AS active_mentees,
+		       (SELECT COUNT(*) FROM unnest(COALESCE(u.skills, '{}')) s WHERE lower(s) = ANY($1)) AS matched_skills
+		FROM users u
+		WHERE u.role = 'mentor' AND u.deleted_at IS NULL AND u.suspended_at IS NULL
+		  AND ($3 = 0 OR u.organization_id = $3)
+		  AND ($2 = '' OR u.department ILIKE $2)
+		  AND (cardinality($1::text[]) = 0 OR EXISTS (SELECT 1 FROM unnest(COALESCE(u.skills, '{}')) s WHERE lower(s) = ANY($1)))
+		ORDER BY matched_skills DESC, u.name
+	`, pq.Array(skills), c.Query("department"), tenantScope(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	onlyAvailable := c.Query("available") == "true"
+	mentors := []MentorProfile{}
+	for rows.Next() {
+		var m MentorProfile
+		err := rows.Scan(&m.ID, &m.Email, &m.Name, &m.Role, &m.Avatar, &m.Department, &m.Company, &m.Bio,
+			pq.Array(&m.Skills), &m.Experience, &m.CreatedAt, &m.Capacity, &m.ActiveMentees, &m.MatchedSkills)
+		if err != nil {
+			continue
+		}
+		m.Available = m.ActiveMentees < m.Capacity
+		if onlyAvailable && !m.Available {
+			continue
+		}
+		mentors = append(mentors, m)
+	}
+
+	c.JSON(http.StatusOK, mentors)
+}
+
+func getMentorships(c *gin.Context) {
+	userID := currentUserID(c)
+	rows, err := db.Query(mentorshipSelect+`
+		WHERE (m.mentor_id = $1 OR m.student_id = $1) AND ($2 = '' OR m.status = $2)
+		ORDER BY m.requested_at DESC
+	`, userID, c.Query("status"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	mentorships := []Mentorship{}
+	for rows.Next() {
+		m, err := scanMentorship(rows)
+		if err != nil {
+			continue
+		}
+		mentorships = append(mentorships, m)
+	}
+
+	c.JSON(http.StatusOK, mentorships)
+}
+
+func requestMentorship(c *gin.Context) {
+	var req MentorshipRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if currentUserRole(c) != "student" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only students can request mentorships"})
+		return
+	}
+
+	var role, studentName string
+	err := db.QueryRow(
+		"SELECT role FROM users WHERE id = $1 AND deleted_at IS NULL AND suspended_at IS NULL AND ($2 = 0 OR organization_id = $2)",
+		req.MentorID, tenantScope(c),
+	).Scan(&role)
+	if err != nil || role != "mentor" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Mentor not found"})
+		return
+	}
+	db.QueryRow("SELECT name FROM users WHERE id = $1", currentUserID(c)).Scan(&studentName)
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	var id int
+	err = tx.QueryRow(
+		"INSERT INTO mentorships (mentor_id, student_id, message) VALUES ($1, $2, $3) RETURNING id",
+		req.MentorID, currentUserID(c), req.Message,
+	).Scan(&id)
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "A mentorship with this mentor is already requested or active"})
+		return
+	}
+
+	data := map[string]interface{}{"mentorship_id": id, "student_id": currentUserID(c), "student_name": studentName}
+	err = dispatchEvent(tx, DomainEvent{
+		Type:       EventMentorshipRequested,
+		ActorID:    currentUserID(c),
+		Recipients: []int{req.MentorID},
+		Data:       data,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	publishRealtime(EventMentorshipRequested, []int{req.MentorID}, data)
+
+	c.JSON(http.StatusCreated, gin.H{"id": id, "message": "Mentorship requested successfully"})
+}
+
+// respondToMentorship accepts or declines a pending request. Accepting locks the
+// mentor's row so concurrent accepts cannot exceed the mentor's capacity.
+func respondToMentorship(accept bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := paramID(c, "id")
+		if !ok {
+			return
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		defer tx.Rollback()
+
+		m, err := scanMentorship(tx.QueryRow(mentorshipSelect+" WHERE m.id = $1 FOR UPDATE OF m", id))
+		if err == sql.ErrNoRows || (err == nil && m.MentorID != currentUserID(c)) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Mentorship not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if m.Status != "requested" {
+			c.JSON(http.StatusConflict, gin.H{"error": "Mentorship is not awaiting a response"})
+			return
+		}
+
+		status, eventType := "declined", EventMentorshipDeclined
+		if accept {
+			var capacity, active int
+			err := tx.QueryRow(`
+				SELECT u.mentorship_capacity,
+				       (SELECT COUNT(*) FROM mentorships WHERE mentor_id = u.id AND status = 'active')
+				FROM users u WHERE u.id = $1 FOR UPDATE
+			`, m.MentorID).Scan(&capacity, &active)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			if active >= capacity {
+				c.JSON(http.StatusConflict, gin.H{"error": "Mentorship capacity reached"})
+				return
+			}
+			status, eventType = "active", EventMentorshipAccepted
+		}
+
+		if _, err := tx.Exec("UPDATE mentorships SET status = $1, responded_at = CURRENT_TIMESTAMP WHERE id = $2", status, id); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		data := map[string]interface{}{"mentorship_id": id, "mentor_id": m.MentorID, "mentor_name": m.MentorName}
+		err = dispatchEvent(tx, DomainEvent{Type: eventType, ActorID: currentUserID(c), Recipients: []int{m.StudentID}, Data: data})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := tx.Commit(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		publishRealtime(eventType, []int{m.StudentID}, data)
+
+		c.JSON(http.StatusOK, gin.H{"message": "Mentorship " + status})
+	}
+}
+
+// endMentorship ends an active mentorship, or withdraws a pending request when the
+// student calls it before the mentor has responded.
+func endMentorship(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+	var req EndMentorshipRequest
+	c.ShouldBindJSON(&req)
+
+	userID := currentUserID(c)
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	m, err := scanMentorship(tx.QueryRow(mentorshipSelect+" WHERE m.id = $1 FOR UPDATE OF m", id))
+	if err == sql.ErrNoRows || (err == nil && m.MentorID != userID && m.StudentID != userID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Mentorship not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var status string
+	switch {
+	case m.Status == "active":
+		status = "ended"
+	case m.Status == "requested" && m.StudentID == userID:
+		status = "cancelled"
+	default:
+		c.JSON(http.StatusConflict, gin.H{"error": "Mentorship cannot be ended"})
+		return
+	}
+
+	_, err = tx.Exec(
+		"UPDATE mentorships SET status = $1, ended_at = CURRENT_TIMESTAMP, ended_by = $2, end_reason = $3 WHERE id = $4",
+		status, userID, req.Reason, id,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	otherID := m.MentorID
+	if userID == m.MentorID {
+		otherID = m.StudentID
+	}
+	data := map[string]interface{}{"mentorship_id": id, "mentor_name": m.MentorName, "student_name": m.StudentName}
+	if status == "ended" {
+		err = dispatchEvent(tx, DomainEvent{Type: EventMentorshipEnded, ActorID: userID, Recipients: []int{otherID}, Data: data})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if status == "ended" {
+		publishRealtime(EventMentorshipEnded, []int{otherID}, data)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Mentorship " + status})
+}
+
+func updateMentorshipCapacity(c *gin.Context) {
+	var req CapacityRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	_, err := db.Exec("UPDATE users SET mentorship_capacity = $1 WHERE id = $2", req.Capacity, currentUserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Set(auditEntityIDKey, currentUserID(c))
+	c.JSON(http.StatusOK, gin.H{"message": "Capacity updated successfully"})
+}
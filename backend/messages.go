@@ -0,0 +1,411 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+type Conversation struct {
+	ID            int                       `json:"id" db:"id"`
+	Subject       *string                   `json:"subject" db:"subject"`
+	ApplicationID *int                      `json:"application_id" db:"application_id"`
+	InternshipID  *int                      `json:"internship_id" db:"internship_id"`
+	CreatedBy     *int                      `json:"created_by" db:"created_by"`
+	CreatedAt     time.Time                 `json:"created_at" db:"created_at"`
+	LastMessageAt time.Time                 `json:"last_message_at" db:"last_message_at"`
+	LastMessage   *string                   `json:"last_message"`
+	UnreadCount   int                       `json:"unread_count"`
+	Participants  []ConversationParticipant `json:"participants"`
+}
+
+type ConversationParticipant struct {
+	UserID     int        `json:"user_id" db:"user_id"`
+	Name       string     `json:"name" db:"name"`
+	Role       string     `json:"role" db:"role"`
+	Avatar     *string    `json:"avatar" db:"avatar"`
+	LastReadAt *time.Time `json:"last_read_at" db:"last_read_at"`
+}
+
+type Message struct {
+	ID             int       `json:"id" db:"id"`
+	ConversationID int       `json:"conversation_id" db:"conversation_id"`
+	SenderID       *int      `json:"sender_id" db:"sender_id"`
+	Body           string    `json:"body" db:"body"`
+	SentAt         time.Time `json:"sent_at" db:"sent_at"`
+}
+
+type CreateConversationRequest struct {
+	ParticipantIDs []int   `json:"participant_ids" binding:"required"`
+	Subject        *string `json:"subject"`
+	ApplicationID  *int    `json:"application_id"`
+	InternshipID   *int    `json:"internship_id"`
+	Message        string  `json:"message" binding:"required"`
+}
+
+type SendMessageRequest struct {
+	Body string `json:"body" binding:"required"`
+}
+
+// isConversationParticipant reports whether the user takes part in the conversation.
+func isConversationParticipant(conversationID, userID int) (bool, error) {
+	var exists bool
+	err := db.QueryRow(
+		"SELECT EXISTS (SELECT 1 FROM conversation_participants WHERE conversation_id = $1 AND user_id = $2)",
+		conversationID, userID,
+	).Scan(&exists)
+	return exists, err
+}
+
+// canLinkApplication reports whether the user is the applicant or the mentor of the
+// application's internship, which is required to attach a conversation to it.
+func canLinkApplication(applicationID, userID int) (bool, error) {
+	var allowed bool
+	err := db.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM applications a
+			JOIN internships i ON i.id = a.internship_id
+			WHERE a.id = $1 AND (a.student_id = $2 OR i.mentor_id = $2)
+		)`, applicationID, userID,
+	).Scan(&allowed)
+	return allowed, err
+}
+
+func getConversations(c *gin.Context) {
+	userID := currentUserID(c)
+	rows, err := db.Query(`
+		SELECT c.id, c.subject, c.application_id, c.internship_id, c.created_by, c.created_at, c.last_message_at,
+		       (SELECT m.body FROM messages m WHERE m.conversation_id = c.id ORDER BY m.sent_at DESC, m.id DESC LIMIT 1),
+		       (SELECT COUNT(*) FROM messages m
+		        WHERE m.conversation_id = c.id AND m.sender_id IS DISTINCT FROM $1
+		          AND m.sent_at > COALESCE(cp.last_read_at, 'epoch'))
+		FROM conversations c
+		JOIN conversation_participants cp ON cp.conversation_id = c.id AND cp.user_id = $1
+		ORDER BY c.last_message_at DESC
+	`, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	conversations := []Conversation{}
+	index := map[int]int{}
+	for rows.Next() {
+		var conv Conversation
+		err := rows.Scan(&conv.ID, &conv.Subject, &conv.ApplicationID, &conv.InternshipID, &conv.CreatedBy,
+			&conv.CreatedAt, &conv.LastMessageAt, &conv.LastMessage, &conv.UnreadCount)
+		if err != nil {
+			continue
+		}
+		conv.Participants = []ConversationParticipant{}
+		index[conv.ID] = len(conversations)
+		conversations = append(conversations, conv)
+	}
+
+	participants, err := db.Query(`
+		SELECT cp.conversation_id, u.id, u.name, u.role, u.avatar, cp.last_read_at
+		FROM conversation_participants cp
+		JOIN users u ON u.id = cp.user_id
+		WHERE cp.conversation_id IN (SELECT conversation_id FROM conversation_participants WHERE user_id = $1)
+		ORDER BY cp.joined_at
+	`, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer participants.Close()
+
+	for participants.Next() {
+		var conversationID int
+		var p ConversationParticipant
+		if err := participants.Scan(&conversationID, &p.UserID, &p.Name, &p.Role, &p.Avatar, &p.LastReadAt); err != nil {
+			continue
+		}
+		if i, ok := index[conversationID]; ok {
+			conversations[i].Participants = append(conversations[i].Participants, p)
+		}
+	}
+
+	c.JSON(http.StatusOK, conversations)
+}
+
+func createConversation(c *gin.Context) {
+	var req CreateConversationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := currentUserID(c)
+
+	// Build a sorted, de-duplicated participant set that always includes the caller
+	seen := map[int]bool{userID: true}
+	participantIDs := []int{userID}
+	for _, id := range req.ParticipantIDs {
+		if !seen[id] {
+			seen[id] = true
+			participantIDs = append(participantIDs, id)
+		}
+	}
+	if len(participantIDs) < 2 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "At least one other participant is required"})
+		return
+	}
+	sort.Ints(participantIDs)
+
+	var found int
+	err := db.QueryRow(
+		`SELECT COUNT(*) FROM users
+		 WHERE id = ANY($1) AND deleted_at IS NULL AND suspended_at IS NULL AND ($2 = 0 OR organization_id = $2)`,
+		pq.Array(participantIDs), tenantScope(c),
+	).Scan(&found)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if found != len(participantIDs) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown participant"})
+		return
+	}
+
+	if req.ApplicationID != nil {
+		allowed, err := canLinkApplication(*req.ApplicationID, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if !allowed {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Not allowed to link this application"})
+			return
+		}
+	}
+	if req.InternshipID != nil {
+		found, err := internshipInScope(db, tenantScope(c), *req.InternshipID)
+		if !requireInScope(c, found, err, "Internship not found") {
+			return
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	// Reuse an existing thread with the same participants and links
+	var conversationID int
+	err = tx.QueryRow(`
+		SELECT c.id FROM conversations c
+		WHERE c.application_id IS NOT DISTINCT FROM $1
+		  AND c.internship_id IS NOT DISTINCT FROM $2
+		  AND (SELECT array_agg(cp.user_id ORDER BY cp.user_id) FROM conversation_participants cp WHERE cp.conversation_id = c.id) = $3::int[]
+		LIMIT 1
+	`, req.ApplicationID, req.InternshipID, pq.Array(participantIDs)).Scan(&conversationID)
+
+	created := false
+	if err == sql.ErrNoRows {
+		err = tx.QueryRow(
+			"INSERT INTO conversations (subject, application_id, internship_id, created_by) VALUES ($1, $2, $3, $4) RETURNING id",
+			req.Subject, req.ApplicationID, req.InternshipID, userID,
+		).Scan(&conversationID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		for _, id := range participantIDs {
+			if _, err := tx.Exec("INSERT INTO conversation_participants (conversation_id, user_id) VALUES ($1, $2)", conversationID, id); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		created = true
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	msg, err := insertMessage(tx, conversationID, userID, req.Message)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	publishRealtime(EventMessageCreated, conversationRecipients(conversationID, userID), msg)
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	c.JSON(status, gin.H{"id": conversationID, "message": msg})
+}
+
+// insertMessage stores a message, bumps the thread's activity timestamp and marks
+// the thread as read for the sender.
+func insertMessage(tx *sql.Tx, conversationID, senderID int, body string) (Message, error) {
+	msg := Message{ConversationID: conversationID, SenderID: &senderID, Body: body}
+	err := tx.QueryRow(
+		"INSERT INTO messages (conversation_id, sender_id, body) VALUES ($1, $2, $3) RETURNING id, sent_at",
+		conversationID, senderID, body,
+	).Scan(&msg.ID, &msg.SentAt)
+	if err != nil {
+		return msg, err
+	}
+
+	if _, err := tx.Exec("UPDATE conversations SET last_message_at = $1 WHERE id = $2", msg.SentAt, conversationID); err != nil {
+		return msg, err
+	}
+
+	_, err = tx.Exec(
+		"UPDATE conversation_participants SET last_read_at = $1 WHERE conversation_id = $2 AND user_id = $3",
+		msg.SentAt, conversationID, senderID,
+	)
+	return msg, err
+}
+
+func getMessages(c *gin.Context) {
+	conversationID, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+
+	member, err := isConversationParticipant(conversationID, currentUserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !member {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Conversation not found"})
+		return
+	}
+
+	limit := 50
+	if l, err := strconv.Atoi(c.Query("limit")); err == nil && l > 0 && l <= 200 {
+		limit = l
+	}
+
+	// Page backwards from an optional message ID, newest first
+	before := 0
+	if b, err := strconv.Atoi(c.Query("before")); err == nil {
+		before = b
+	}
+
+	rows, err := db.Query(`
+		SELECT id, conversation_id, sender_id, body, sent_at FROM messages
+		WHERE conversation_id = $1 AND ($2 = 0 OR id < $2)
+		ORDER BY id DESC
+		LIMIT $3
+	`, conversationID, before, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	messages := []Message{}
+	for rows.Next() {
+		var msg Message
+		if err := rows.Scan(&msg.ID, &msg.ConversationID, &msg.SenderID, &msg.Body, &msg.SentAt); err != nil {
+			continue
+		}
+		messages = append(messages, msg)
+	}
+
+	c.JSON(http.StatusOK, messages)
+}
+
+func sendMessage(c *gin.Context) {
+	conversationID, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+
+	var req SendMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := currentUserID(c)
+	member, err := isConversationParticipant(conversationID, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !member {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Conversation not found"})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	msg, err := insertMessage(tx, conversationID, userID, req.Body)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	publishRealtime(EventMessageCreated, conversationRecipients(conversationID, userID), msg)
+
+	c.JSON(http.StatusCreated, msg)
+}
+
+func markConversationRead(c *gin.Context) {
+	conversationID, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+
+	result, err := db.Exec(
+		"UPDATE conversation_participants SET last_read_at = CURRENT_TIMESTAMP WHERE conversation_id = $1 AND user_id = $2",
+		conversationID, currentUserID(c),
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Conversation not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Conversation marked as read"})
+}
+
+func getUnreadCount(c *gin.Context) {
+	var unread, conversations int
+	err := db.QueryRow(`
+		SELECT COUNT(m.id), COUNT(DISTINCT m.conversation_id)
+		FROM conversation_participants cp
+		JOIN messages m ON m.conversation_id = cp.conversation_id
+		WHERE cp.user_id = $1 AND m.sender_id IS DISTINCT FROM $1
+		  AND m.sent_at > COALESCE(cp.last_read_at, 'epoch')
+	`, currentUserID(c)).Scan(&unread, &conversations)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"unread": unread, "conversations": conversations})
+}
@@ -0,0 +1,400 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	ChannelInApp = "in_app"
+	ChannelEmail = "email"
+)
+
+// notificationEventTypes lists the events users can configure preferences for.
+var notificationEventTypes = []string{
+	EventApplicationCreated,
+	EventApplicationStatusChanged,
+	EventInterviewScheduled,
+	EventDeadlineApproaching,
+	EventMentorshipRequested,
+	EventMentorshipAccepted,
+	EventMentorshipDeclined,
+	EventMentorshipEnded,
+	EventMeetingBooked,
+	EventMeetingCancelled,
+	EventMeetingRescheduled,
+	EventTimesheetSubmitted,
+	EventTimesheetApproved,
+	EventTimesheetRejected,
+	EventGoalAssigned,
+	EventMilestoneCompleted,
+	EventEvaluationOpened,
+	EventEvaluationSubmitted,
+	EventSavedSearchMatched,
+	EventInternshipClosed,
+	EventInternshipPublished,
+}
+
+var notificationChannels = []string{ChannelInApp, ChannelEmail}
+
+type Notification struct {
+	ID        int             `json:"id" db:"id"`
+	UserID    int             `json:"user_id" db:"user_id"`
+	Type      string          `json:"type" db:"type"`
+	Title     string          `json:"title" db:"title"`
+	Body      string          `json:"body" db:"body"`
+	Data      json.RawMessage `json:"data" db:"data"`
+	ReadAt    *time.Time      `json:"read_at" db:"read_at"`
+	CreatedAt time.Time       `json:"created_at" db:"created_at"`
+}
+
+type NotificationPreference struct {
+	EventType string `json:"event_type" db:"event_type" binding:"required"`
+	Channel   string `json:"channel" db:"channel" binding:"required"`
+	Enabled   bool   `json:"enabled" db:"enabled"`
+}
+
+func init() {
+	onDomainEvent(createNotifications)
+}
+
+// notificationContent renders the title and body shown for an event.
+func notificationContent(event DomainEvent) (string, string, bool) {
+	d := event.Data
+	switch event.Type {
+	case EventApplicationCreated:
+		return fmt.Sprintf("New application for %v", d["internship_title"]),
+			fmt.Sprintf("%v applied to %v.", d["student_name"], d["internship_title"]), true
+	case EventApplicationStatusChanged:
+		return fmt.Sprintf("Application update: %v", d["internship_title"]),
+			fmt.Sprintf("Your application for %v is now %v.", d["internship_title"], d["status"]), true
+	case EventInterviewScheduled:
+		return fmt.Sprintf("Interview for %v", d["internship_title"]),
+			fmt.Sprintf("You have been invited to interview for %v.", d["internship_title"]), true
+	case EventDeadlineApproaching:
+		return fmt.Sprintf("Deadline approaching: %v", d["internship_title"]),
+			fmt.Sprintf("Applications for %v close on %v.", d["internship_title"], d["deadline"]), true
+	case EventMentorshipRequested:
+		return "New mentorship request",
+			fmt.Sprintf("%v would like you to be their mentor.", d["student_name"]), true
+	case EventMentorshipAccepted:
+		return "Mentorship request accepted",
+			fmt.Sprintf("%v accepted your mentorship request.", d["mentor_name"]), true
+	case EventMentorshipDeclined:
+		return "Mentorship request declined",
+			fmt.Sprintf("%v is not able to take on your mentorship request right now.", d["mentor_name"]), true
+	case EventMentorshipEnded:
+		return "Mentorship ended",
+			fmt.Sprintf("The mentorship between %v and %v has ended.", d["mentor_name"], d["student_name"]), true
+	case EventMeetingBooked:
+		return fmt.Sprintf("Meeting booked: %v", d["title"]),
+			fmt.Sprintf("%v booked a meeting with you on %v.", d["student_name"], d["starts_at"]), true
+	case EventMeetingCancelled:
+		return fmt.Sprintf("Meeting cancelled: %v", d["title"]),
+			fmt.Sprintf("The meeting on %v has been cancelled.", d["starts_at"]), true
+	case EventMeetingRescheduled:
+		return fmt.Sprintf("Meeting rescheduled: %v", d["title"]),
+			fmt.Sprintf("The meeting on %v has been moved to %v.", d["previous_starts_at"], d["starts_at"]), true
+	case EventTimesheetSubmitted:
+		return fmt.Sprintf("Timesheet submitted: %v", d["internship_title"]),
+			fmt.Sprintf("A timesheet for the week of %v is waiting for your review.", d["week_start"]), true
+	case EventTimesheetApproved:
+		return "Timesheet approved",
+			fmt.Sprintf("Your timesheet for the week of %v was approved.", d["week_start"]), true
+	case EventTimesheetRejected:
+		return "Timesheet needs changes",
+			fmt.Sprintf("Your timesheet for the week of %v was rejected: %v", d["week_start"], derefString(d["comment"])), true
+	case EventGoalAssigned:
+		return "New internship goal",
+			fmt.Sprintf("Your mentor added a goal: %v.", d["title"]), true
+	case EventMilestoneCompleted:
+		return "Milestone completed",
+			fmt.Sprintf("Your intern completed the milestone %v.", d["title"]), true
+	case EventEvaluationOpened:
+		return fmt.Sprintf("Evaluation due: %v", d["template_name"]),
+			fmt.Sprintf("The %v for %v is open until %v.", d["template_name"], d["internship_title"], d["due_on"]), true
+	case EventSavedSearchMatched:
+		return fmt.Sprintf("New internships for %v", d["saved_search_name"]),
+			fmt.Sprintf("%v new internships match your saved search %v.", d["count"], d["saved_search_name"]), true
+	case EventEvaluationSubmitted:
+		return fmt.Sprintf("Evaluation received: %v", d["template_name"]),
+			fmt.Sprintf("%v submitted the %v for %v.", d["evaluator_name"], d["template_name"], d["internship_title"]), true
+	case EventInternshipClosed:
+		return fmt.Sprintf("Internship closed: %v", d["internship_title"]),
+			fmt.Sprintf("The application deadline for %v has passed and the posting was closed.", d["internship_title"]), true
+	case EventInternshipPublished:
+		return fmt.Sprintf("Internship published: %v", d["internship_title"]),
+			fmt.Sprintf("Your scheduled posting %v is now live.", d["internship_title"]), true
+	}
+	return "", "", false
+}
+
+// notificationEnabled reports whether the user wants events of this type on the
+// channel. Channels are enabled unless the user has opted out.
+func notificationEnabled(tx *sql.Tx, userID int, eventType, channel string) (bool, error) {
+	var enabled bool
+	err := tx.QueryRow(
+		"SELECT enabled FROM notification_preferences WHERE user_id = $1 AND event_type = $2 AND channel = $3",
+		userID, eventType, channel,
+	).Scan(&enabled)
+	if err == sql.ErrNoRows {
+		return true, nil
+	}
+	return enabled, err
+}
+
+// createNotifications stores an in-app notification for each recipient of the event.
+func createNotifications(tx *sql.Tx, event DomainEvent) error {
+	title, body, ok := notificationContent(event)
+	if !ok {
+		return nil
+	}
+
+	data, err := json.Marshal(event.Data)
+	if err != nil {
+		return err
+	}
+
+	for _, userID := range event.Recipients {
+		enabled, err := notificationEnabled(tx, userID, event.Type, ChannelInApp)
+		if err != nil {
+			return err
+		}
+		if !enabled {
+			continue
+		}
+
+		_, err = tx.Exec(
+			"INSERT INTO notifications (user_id, type, title, body, data) VALUES ($1, $2, $3, $4, $5)",
+			userID, event.Type, title, body, data,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func getNotifications(c *gin.Context) {
+	limit := 50
+	if l, err := strconv.Atoi(c.Query("limit")); err == nil && l > 0 && l <= 200 {
+		limit = l
+	}
+	unreadOnly := c.Query("unread") == "true"
+
+	rows, err := db.Query(`
+		SELECT id, user_id, type, title, body, data, read_at, created_at FROM notifications
+		WHERE user_id = $1 AND (NOT $2 OR read_at IS NULL)
+		ORDER BY created_at DESC, id DESC
+		LIMIT $3
+	`, currentUserID(c), unreadOnly, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	notifications := []Notification{}
+	for rows.Next() {
+		var n Notification
+		var data []byte
+		if err := rows.Scan(&n.ID, &n.UserID, &n.Type, &n.Title, &n.Body, &data, &n.ReadAt, &n.CreatedAt); err != nil {
+			continue
+		}
+		n.Data = data
+		notifications = append(notifications, n)
+	}
+
+	var unread int
+	db.QueryRow("SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND read_at IS NULL", currentUserID(c)).Scan(&unread)
+
+	c.JSON(http.StatusOK, gin.H{"notifications": notifications, "unread": unread})
+}
+
+func markNotificationRead(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+
+	result, err := db.Exec(
+		"UPDATE notifications SET read_at = COALESCE(read_at, CURRENT_TIMESTAMP) WHERE id = $1 AND user_id = $2",
+		id, currentUserID(c),
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Notification not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Notification marked as read"})
+}
+
+func markAllNotificationsRead(c *gin.Context) {
+	result, err := db.Exec(
+		"UPDATE notifications SET read_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND read_at IS NULL",
+		currentUserID(c),
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	updated, _ := result.RowsAffected()
+	c.JSON(http.StatusOK, gin.H{"message": "All notifications marked as read", "updated": updated})
+}
+
+func getNotificationPreferences(c *gin.Context) {
+	rows, err := db.Query(
+		"SELECT event_type, channel, enabled FROM notification_preferences WHERE user_id = $1",
+		currentUserID(c),
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	stored := map[string]bool{}
+	for rows.Next() {
+		var p NotificationPreference
+		if err := rows.Scan(&p.EventType, &p.Channel, &p.Enabled); err != nil {
+			continue
+		}
+		stored[p.EventType+"/"+p.Channel] = p.Enabled
+	}
+
+	// Report every event type and channel, filling in the enabled default
+	preferences := []NotificationPreference{}
+	for _, eventType := range notificationEventTypes {
+		for _, channel := range notificationChannels {
+			enabled, ok := stored[eventType+"/"+channel]
+			if !ok {
+				enabled = true
+			}
+			preferences = append(preferences, NotificationPreference{EventType: eventType, Channel: channel, Enabled: enabled})
+		}
+	}
+
+	c.JSON(http.StatusOK, preferences)
+}
+
+func updateNotificationPreferences(c *gin.Context) {
+	var preferences []NotificationPreference
+	if err := c.ShouldBindJSON(&preferences); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	for _, p := range preferences {
+		if !contains(notificationEventTypes, p.EventType) || !contains(notificationChannels, p.Channel) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Unknown preference %s/%s", p.EventType, p.Channel)})
+			return
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	for _, p := range preferences {
+		_, err := tx.Exec(`
+			INSERT INTO notification_preferences (user_id, event_type, channel, enabled) VALUES ($1, $2, $3, $4)
+			ON CONFLICT (user_id, event_type, channel) DO UPDATE SET enabled = EXCLUDED.enabled
+		`, currentUserID(c), p.EventType, p.Channel, p.Enabled)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Notification preferences updated successfully"})
+}
+
+// sendDeadlineReminders notifies mentors of active internships whose application
+// deadline is less than three days away. Each internship is reminded once.
+func sendDeadlineReminders() (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`
+		SELECT id, title, mentor_id, deadline FROM internships
+		WHERE status = 'active' AND deadline_reminded_at IS NULL
+		  AND deadline > CURRENT_TIMESTAMP AND deadline <= CURRENT_TIMESTAMP + INTERVAL '3 days'
+		FOR UPDATE SKIP LOCKED
+	`)
+	if err != nil {
+		return 0, err
+	}
+
+	var events []DomainEvent
+	for rows.Next() {
+		var id, mentorID int
+		var title string
+		var deadline time.Time
+		if err := rows.Scan(&id, &title, &mentorID, &deadline); err != nil {
+			continue
+		}
+		events = append(events, DomainEvent{
+			Type:       EventDeadlineApproaching,
+			Recipients: []int{mentorID},
+			Data: map[string]interface{}{
+				"internship_id":    id,
+				"internship_title": title,
+				"deadline":         deadline.Format("Jan 2, 2006"),
+			},
+		})
+	}
+	rows.Close()
+
+	for _, event := range events {
+		if err := dispatchEvent(tx, event); err != nil {
+			return 0, err
+		}
+		if _, err := tx.Exec("UPDATE internships SET deadline_reminded_at = CURRENT_TIMESTAMP WHERE id = $1", event.Data["internship_id"]); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(events), tx.Commit()
+}
+
+// derefString formats an optional string stored in event data.
+func derefString(v interface{}) string {
+	if s, ok := v.(*string); ok && s != nil {
+		return *s
+	}
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return ""
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"embed"
+	"encoding/json"
+	"html/template"
+	"io/fs"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+//go:embed templates/email/*.html
+var emailTemplateFS embed.FS
+
+var emailTemplates sync.Map
+
+// sqlExecer is satisfied by both *sql.DB and *sql.Tx.
+type sqlExecer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// EmailTemplateData is passed to every email template.
+type EmailTemplateData struct {
+	Subject string
+	Name    string
+	AppURL  string
+	Data    map[string]interface{}
+}
+
+func init() {
+	onDomainEvent(enqueueEventEmails)
+}
+
+func appURL() string {
+	if url := os.Getenv("APP_URL"); url != "" {
+		return url
+	}
+	return "http://localhost:5173"
+}
+
+func hasEmailTemplate(name string) bool {
+	_, err := fs.Stat(emailTemplateFS, "templates/email/"+name+".html")
+	return err == nil
+}
+
+// renderEmail renders the named template inside the shared layout.
+func renderEmail(name string, data EmailTemplateData) (string, error) {
+	cached, ok := emailTemplates.Load(name)
+	if !ok {
+		t, err := template.ParseFS(emailTemplateFS, "templates/email/layout.html", "templates/email/"+name+".html")
+		if err != nil {
+			return "", err
+		}
+		cached, _ = emailTemplates.LoadOrStore(name, t)
+	}
+
+	var buf bytes.Buffer
+	if err := cached.(*template.Template).ExecuteTemplate(&buf, "layout", data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// enqueueEmail adds an email to the outbox. Pass the transaction of the change that
+// triggers the email so both are committed together.
+func enqueueEmail(ex sqlExecer, userID *int, to, name, templateName, subject string, data map[string]interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	_, err = ex.Exec(`
+		INSERT INTO email_outbox (recipient_user_id, recipient_email, recipient_name, template, subject, data)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, userID, to, name, templateName, subject, payload)
+	return err
+}
+
+// enqueueEventEmails queues an email for each recipient who has the email channel
+// enabled for the event.
+func enqueueEventEmails(tx *sql.Tx, event DomainEvent) error {
+	if !hasEmailTemplate(event.Type) {
+		return nil
+	}
+	subject, _, ok := notificationContent(event)
+	if !ok {
+		return nil
+	}
+
+	for _, userID := range event.Recipients {
+		enabled, err := notificationEnabled(tx, userID, event.Type, ChannelEmail)
+		if err != nil {
+			return err
+		}
+		if !enabled {
+			continue
+		}
+
+		var email, name string
+		if err := tx.QueryRow("SELECT email, name FROM users WHERE id = $1", userID).Scan(&email, &name); err != nil {
+			return err
+		}
+
+		id := userID
+		if err := enqueueEmail(tx, &id, email, name, event.Type, subject, event.Data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type outboxEmail struct {
+	ID          int
+	To          string
+	Name        string
+	Template    string
+	Subject     string
+	Data        []byte
+	Attempts    int
+	MaxAttempts int
+}
+
+// startOutboxWorker delivers pending outbox emails. It polls every interval while
+// the outbox is empty and drains it in batches otherwise.
+func startOutboxWorker(mailer Mailer, interval time.Duration) {
+	go func() {
+		for {
+			sent, err := processOutbox(mailer, 20)
+			if err != nil {
+				log.Printf("Error processing email outbox: %v", err)
+			}
+			if sent == 0 || err != nil {
+				time.Sleep(interval)
+			}
+		}
+	}()
+}
+
+// outboxLease is how long a claimed email is hidden from other workers. An email
+// whose worker dies while sending it is retried once the lease expires.
+const outboxLease = 5 * time.Minute
+
+// processOutbox delivers a batch of due emails. The batch is claimed by pushing its
+// next_attempt_at past the lease in a short transaction, so several instances can
+// run the worker without sending duplicates and no rows stay locked while sending.
+func processOutbox(mailer Mailer, batch int) (int, error) {
+	rows, err := db.Query(`
+		UPDATE email_outbox SET next_attempt_at = CURRENT_TIMESTAMP + $2 * INTERVAL '1 second'
+		WHERE id IN (
+			SELECT id FROM email_outbox
+			WHERE status = 'pending' AND next_attempt_at <= CURRENT_TIMESTAMP
+			ORDER BY next_attempt_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, recipient_email, COALESCE(recipient_name, ''), template, subject, data, attempts, max_attempts
+	`, batch, int(outboxLease.Seconds()))
+	if err != nil {
+		return 0, err
+	}
+
+	var emails []outboxEmail
+	for rows.Next() {
+		var e outboxEmail
+		if err := rows.Scan(&e.ID, &e.To, &e.Name, &e.Template, &e.Subject, &e.Data, &e.Attempts, &e.MaxAttempts); err != nil {
+			continue
+		}
+		emails = append(emails, e)
+	}
+	rows.Close()
+
+	// Each result is recorded on its own, so a failure only leaves that email to be
+	// retried after the lease
+	for _, e := range emails {
+		if err := deliverOutboxEmail(db, mailer, e); err != nil {
+			log.Printf("Error recording delivery of email %d: %v", e.ID, err)
+		}
+	}
+
+	return len(emails), nil
+}
+
+func deliverOutboxEmail(ex sqlExecer, mailer Mailer, e outboxEmail) error {
+	data := EmailTemplateData{Subject: e.Subject, Name: e.Name, AppURL: appURL()}
+	if err := json.Unmarshal(e.Data, &data.Data); err != nil {
+		return markOutboxFailed(ex, e.ID, err)
+	}
+
+	body, err := renderEmail(e.Template, data)
+	if err != nil {
+		// Rendering errors will not go away by retrying
+		return markOutboxFailed(ex, e.ID, err)
+	}
+
+	if err := mailer.Send(EmailMessage{To: e.To, Subject: e.Subject, HTMLBody: body}); err != nil {
+		attempts := e.Attempts + 1
+		if attempts >= e.MaxAttempts {
+			return markOutboxFailed(ex, e.ID, err)
+		}
+		_, err := ex.Exec(`
+			UPDATE email_outbox
+			SET attempts = $1, last_error = $2, next_attempt_at = CURRENT_TIMESTAMP + $3 * INTERVAL '1 second'
+			WHERE id = $4
+		`, attempts, err.Error(), int(outboxBackoff(attempts).Seconds()), e.ID)
+		return err
+	}
+
+	_, err = ex.Exec(
+		"UPDATE email_outbox SET status = 'sent', attempts = attempts + 1, sent_at = CURRENT_TIMESTAMP, last_error = NULL WHERE id = $1",
+		e.ID,
+	)
+	return err
+}
+
+func markOutboxFailed(ex sqlExecer, id int, cause error) error {
+	log.Printf("Email %d failed permanently: %v", id, cause)
+	_, err := ex.Exec(
+		"UPDATE email_outbox SET status = 'failed', attempts = attempts + 1, last_error = $1 WHERE id = $2",
+		cause.Error(), id,
+	)
+	return err
+}
+
+// outboxBackoff doubles the retry delay per attempt, starting at one minute and
+// capped at one hour.
+func outboxBackoff(attempts int) time.Duration {
+	delay := time.Minute << uint(attempts-1)
+	if delay <= 0 || delay > time.Hour {
+		delay = time.Hour
+	}
+	return delay
+}
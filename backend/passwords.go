@@ -0,0 +1,166 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Password tokens let a user choose a password through an emailed link: invited
+// users set their first password and others reset theirs. Only a hash of the token
+// is stored, and a token works once.
+
+const (
+	passwordTokenInvite = "invite"
+	passwordTokenReset  = "reset"
+
+	inviteTokenTTL = 7 * 24 * time.Hour
+	resetTokenTTL  = 24 * time.Hour
+
+	minPasswordLength = 8
+)
+
+type SetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+// issuePasswordToken invalidates the user's unused tokens and creates a new one,
+// returning the link to set a password with it.
+func issuePasswordToken(ex sqlExecer, userID int, purpose string, ttl time.Duration) (string, error) {
+	token, err := generateSecret()
+	if err != nil {
+		return "", err
+	}
+	_, err = ex.Exec(
+		"UPDATE password_tokens SET used_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND used_at IS NULL", userID,
+	)
+	if err != nil {
+		return "", err
+	}
+	_, err = ex.Exec(`
+		INSERT INTO password_tokens (token_hash, user_id, purpose, expires_at) VALUES ($1, $2, $3, $4)
+	`, hashToken(token), userID, purpose, time.Now().UTC().Add(ttl))
+	if err != nil {
+		return "", err
+	}
+	return appURL() + "/set-password?token=" + url.QueryEscape(token), nil
+}
+
+// sendInvitation emails the user a link to set their first password.
+func sendInvitation(ex sqlExecer, userID int, email, name string) error {
+	link, err := issuePasswordToken(ex, userID, passwordTokenInvite, inviteTokenTTL)
+	if err != nil {
+		return err
+	}
+	return enqueueEmail(ex, &userID, email, name, "account.invited", "You are invited to the LMS Internship Portal",
+		map[string]interface{}{
+			"url":        link,
+			"expires_on": time.Now().Add(inviteTokenTTL).Format("January 2, 2006"),
+		})
+}
+
+// setPassword sets the password of the user a password token was issued to. The
+// route is public; the token authenticates the request.
+func setPassword(c *gin.Context) {
+	var req SetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(req.Password) < minPasswordLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Password must be at least 8 characters"})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	var tokenID, userID int
+	err = tx.QueryRow(`
+		SELECT id, user_id FROM password_tokens
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > $2
+		FOR UPDATE
+	`, hashToken(req.Token), time.Now().UTC()).Scan(&tokenID, &userID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired token"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not hash password"})
+		return
+	}
+	if _, err := tx.Exec("UPDATE users SET password_hash = $1 WHERE id = $2", string(hashedPassword), userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if _, err := tx.Exec("UPDATE password_tokens SET used_at = CURRENT_TIMESTAMP WHERE id = $1", tokenID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Set(auditEntityIDKey, userID)
+	c.JSON(http.StatusOK, gin.H{"message": "Password set successfully"})
+}
+
+// resendInvitation emails an imported user a new invitation, invalidating the
+// previous link. Users who already set a password cannot be invited again.
+func resendInvitation(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+
+	var email, name, passwordHash string
+	err := db.QueryRow(
+		"SELECT email, name, password_hash FROM users WHERE id = $1 AND deleted_at IS NULL AND ($2 = 0 OR organization_id = $2)",
+		id, tenantScope(c),
+	).Scan(&email, &name, &passwordHash)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if passwordHash != "" {
+		c.JSON(http.StatusConflict, gin.H{"error": "User has already set a password"})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+	if err := sendInvitation(tx, id, email, name); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Invitation sent"})
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	pdfPageWidth  = 612.0 // US Letter, in points
+	pdfPageHeight = 792.0
+	pdfMargin     = 50.0
+)
+
+// PDFWriter produces simple text documents (headings, paragraphs and tables) using
+// the standard Helvetica fonts. Finished pages are written to the underlying writer
+// immediately, so long documents are not held in memory.
+type PDFWriter struct {
+	w       io.Writer
+	offset  int64
+	offsets map[int]int64
+	nextID  int
+	pageIDs []int
+	page    *bytes.Buffer
+	y       float64
+	err     error
+}
+
+func NewPDFWriter(w io.Writer) *PDFWriter {
+	p := &PDFWriter{w: w, offsets: map[int]int64{}, nextID: 5}
+	p.write("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	p.object(3, "<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	p.object(4, "<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	return p
+}
+
+func (p *PDFWriter) write(s string) {
+	if p.err != nil {
+		return
+	}
+	n, err := io.WriteString(p.w, s)
+	p.offset += int64(n)
+	p.err = err
+}
+
+func (p *PDFWriter) object(id int, body string) {
+	p.offsets[id] = p.offset
+	p.write(fmt.Sprintf("%d 0 obj\n%s\nendobj\n", id, body))
+}
+
+// ensureSpace starts a new page when fewer than height points are left.
+func (p *PDFWriter) ensureSpace(height float64) {
+	if p.page == nil || p.y-height < pdfMargin {
+		p.newPage()
+	}
+}
+
+func (p *PDFWriter) newPage() {
+	p.flushPage()
+	p.page = &bytes.Buffer{}
+	p.y = pdfPageHeight - pdfMargin
+}
+
+func (p *PDFWriter) flushPage() {
+	if p.page == nil {
+		return
+	}
+	contentID, pageID := p.nextID, p.nextID+1
+	p.nextID += 2
+
+	p.object(contentID, fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", p.page.Len(), p.page.String()))
+	p.object(pageID, fmt.Sprintf(
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] /Contents %d 0 R /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> >>",
+		pdfPageWidth, pdfPageHeight, contentID,
+	))
+	p.pageIDs = append(p.pageIDs, pageID)
+	p.page = nil
+}
+
+// textAt draws a single line of text with its baseline at the current position.
+func (p *PDFWriter) textAt(x float64, text string, bold bool, size float64) {
+	font := "F1"
+	if bold {
+		font = "F2"
+	}
+	fmt.Fprintf(p.page, "BT /%s %.1f Tf %.2f %.2f Td (%s) Tj ET\n", font, size, x, p.y, pdfEscape(text))
+}
+
+// Heading writes a bold title line.
+func (p *PDFWriter) Heading(text string, size float64) {
+	p.ensureSpace(size * 1.6)
+	p.y -= size
+	p.textAt(pdfMargin, text, true, size)
+	p.y -= size * 0.6
+}
+
+// Paragraph writes wrapped text.
+func (p *PDFWriter) Paragraph(text string, size float64) {
+	for _, line := range wrapText(text, pdfPageWidth-2*pdfMargin, size) {
+		p.ensureSpace(size * 1.4)
+		p.y -= size * 1.4
+		p.textAt(pdfMargin, line, false, size)
+	}
+}
+
+// Field writes a bold label followed by wrapped text.
+func (p *PDFWriter) Field(label, value string, size float64) {
+	p.ensureSpace(size * 2.8)
+	p.y -= size * 1.4
+	p.textAt(pdfMargin, label, true, size)
+	p.Paragraph(value, size)
+	p.y -= size * 0.6
+}
+
+// TableRow writes one row of cells in columns of equal width, truncating cells that
+// do not fit. Header rows are bold and underlined.
+func (p *PDFWriter) TableRow(cells []string, header bool, size float64) {
+	if len(cells) == 0 {
+		return
+	}
+	p.ensureSpace(size * 1.6)
+	p.y -= size * 1.4
+
+	width := (pdfPageWidth - 2*pdfMargin) / float64(len(cells))
+	for i, cell := range cells {
+		lines := wrapText(cell, width-4, size)
+		text := ""
+		if len(lines) > 0 {
+			text = lines[0]
+			if len(lines) > 1 {
+				text = strings.TrimRight(text, " ") + "..."
+			}
+		}
+		p.textAt(pdfMargin+float64(i)*width, text, header, size)
+	}
+	if header {
+		fmt.Fprintf(p.page, "%.2f %.2f m %.2f %.2f l S\n", pdfMargin, p.y-3, pdfPageWidth-pdfMargin, p.y-3)
+		p.y -= 4
+	}
+}
+
+// Space adds vertical whitespace.
+func (p *PDFWriter) Space(height float64) {
+	p.ensureSpace(height)
+	p.y -= height
+}
+
+// Close writes the page tree, catalog and cross-reference table.
+func (p *PDFWriter) Close() error {
+	if p.page == nil && len(p.pageIDs) == 0 {
+		p.newPage()
+	}
+	p.flushPage()
+
+	kids := make([]string, len(p.pageIDs))
+	for i, id := range p.pageIDs {
+		kids[i] = fmt.Sprintf("%d 0 R", id)
+	}
+	p.object(2, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(p.pageIDs)))
+	p.object(1, "<< /Type /Catalog /Pages 2 0 R >>")
+
+	xref := p.offset
+	p.write(fmt.Sprintf("xref\n0 %d\n0000000000 65535 f \n", p.nextID))
+	for id := 1; id < p.nextID; id++ {
+		p.write(fmt.Sprintf("%010d 00000 n \n", p.offsets[id]))
+	}
+	p.write(fmt.Sprintf("trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", p.nextID, xref))
+	return p.err
+}
+
+// pdfEscape escapes a string for a PDF literal and maps it to WinAnsi (Latin-1);
+// characters outside that range are replaced.
+func pdfEscape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '\t':
+			b.WriteByte(' ')
+		case r < 32:
+			continue
+		case r < 256:
+			b.WriteByte(byte(r))
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
+
+// wrapText splits text into lines that fit width, estimating Helvetica's average
+// glyph width as half the font size.
+func wrapText(text string, width, size float64) []string {
+	maxChars := int(width / (size * 0.5))
+	if maxChars < 1 {
+		maxChars = 1
+	}
+
+	var lines []string
+	for _, paragraph := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		line := ""
+		for _, word := range strings.Fields(paragraph) {
+			for len([]rune(word)) > maxChars {
+				if line != "" {
+					lines = append(lines, line)
+					line = ""
+				}
+				runes := []rune(word)
+				lines = append(lines, string(runes[:maxChars]))
+				word = string(runes[maxChars:])
+			}
+			if line == "" {
+				line = word
+			} else if len([]rune(line))+1+len([]rune(word)) <= maxChars {
+				line += " " + word
+			} else {
+				lines = append(lines, line)
+				line = word
+			}
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
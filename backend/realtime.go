@@ -0,0 +1,279 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// realtimeChannel is the Postgres NOTIFY channel used to fan events out across instances.
+const realtimeChannel = "lms_realtime"
+
+// maxNotifyPayload keeps NOTIFY payloads under Postgres' 8000 byte limit.
+const maxNotifyPayload = 7500
+
+// RealtimeEvent is pushed to connected clients. UserIDs lists the recipients and is
+// never sent to the client itself.
+type RealtimeEvent struct {
+	Type      string      `json:"type"`
+	UserIDs   []int       `json:"user_ids"`
+	Data      interface{} `json:"data,omitempty"`
+	Truncated bool        `json:"truncated,omitempty"`
+}
+
+// Hub keeps the in-process subscriptions of users connected to this instance.
+type Hub struct {
+	mu          sync.RWMutex
+	subscribers map[int]map[chan RealtimeEvent]struct{}
+}
+
+func newHub() *Hub {
+	return &Hub{subscribers: map[int]map[chan RealtimeEvent]struct{}{}}
+}
+
+// Subscribe registers a channel for the user's events. The returned function must be
+// called to release it.
+func (h *Hub) Subscribe(userID int) (<-chan RealtimeEvent, func()) {
+	ch := make(chan RealtimeEvent, 16)
+
+	h.mu.Lock()
+	if h.subscribers[userID] == nil {
+		h.subscribers[userID] = map[chan RealtimeEvent]struct{}{}
+	}
+	h.subscribers[userID][ch] = struct{}{}
+	h.mu.Unlock()
+
+	return ch, func() {
+		h.mu.Lock()
+		delete(h.subscribers[userID], ch)
+		if len(h.subscribers[userID]) == 0 {
+			delete(h.subscribers, userID)
+		}
+		h.mu.Unlock()
+	}
+}
+
+// Deliver fans an event out to the local subscribers of its recipients. Slow clients
+// whose buffer is full miss the event rather than blocking the publisher.
+func (h *Hub) Deliver(event RealtimeEvent) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for _, userID := range event.UserIDs {
+		for ch := range h.subscribers[userID] {
+			select {
+			case ch <- event:
+			default:
+			}
+		}
+	}
+}
+
+// RealtimePublisher sends events to every instance that may hold the recipients' connections.
+type RealtimePublisher interface {
+	Publish(event RealtimeEvent) error
+}
+
+// LocalPublisher delivers events straight to the in-process hub. It is only correct
+// for single instance deployments.
+type LocalPublisher struct {
+	hub *Hub
+}
+
+func (p *LocalPublisher) Publish(event RealtimeEvent) error {
+	p.hub.Deliver(event)
+	return nil
+}
+
+// PostgresPublisher broadcasts events with NOTIFY; every instance, including this one,
+// receives them through listenRealtime and delivers them to its own hub.
+type PostgresPublisher struct{}
+
+func (p *PostgresPublisher) Publish(event RealtimeEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	if len(payload) > maxNotifyPayload {
+		// Clients refetch the resource when they receive a truncated event
+		event.Data = nil
+		event.Truncated = true
+		if payload, err = json.Marshal(event); err != nil {
+			return err
+		}
+	}
+
+	_, err = db.Exec("SELECT pg_notify($1, $2)", realtimeChannel, string(payload))
+	return err
+}
+
+var realtimeHub = newHub()
+var realtimePublisher RealtimePublisher = &LocalPublisher{hub: realtimeHub}
+
+// initRealtime selects the publisher from REALTIME_BACKEND ("local" or "postgres").
+func initRealtime(dbURL string) {
+	if os.Getenv("REALTIME_BACKEND") != "postgres" {
+		return
+	}
+
+	listenRealtime(dbURL, realtimeHub)
+	realtimePublisher = &PostgresPublisher{}
+	log.Println("Realtime events distributed via Postgres LISTEN/NOTIFY")
+}
+
+// listenRealtime subscribes to the NOTIFY channel and feeds received events into the hub.
+func listenRealtime(dbURL string, hub *Hub) {
+	listener := pq.NewListener(dbURL, 10*time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Printf("Realtime listener error: %v", err)
+		}
+	})
+	if err := listener.Listen(realtimeChannel); err != nil {
+		log.Fatal("Failed to listen for realtime events:", err)
+	}
+
+	go func() {
+		for {
+			select {
+			case n := <-listener.Notify:
+				// A nil notification signals a reconnect; events sent meanwhile are lost
+				if n == nil {
+					continue
+				}
+				var event RealtimeEvent
+				if err := json.Unmarshal([]byte(n.Extra), &event); err != nil {
+					log.Printf("Invalid realtime payload: %v", err)
+					continue
+				}
+				hub.Deliver(event)
+			case <-time.After(90 * time.Second):
+				go listener.Ping()
+			}
+		}
+	}()
+}
+
+// publishRealtime pushes an event to the given users, logging rather than failing the
+// request when the event cannot be published.
+func publishRealtime(eventType string, userIDs []int, data interface{}) {
+	if len(userIDs) == 0 {
+		return
+	}
+	event := RealtimeEvent{Type: eventType, UserIDs: userIDs, Data: data}
+	if err := realtimePublisher.Publish(event); err != nil {
+		log.Printf("Error publishing %s event: %v", eventType, err)
+	}
+}
+
+// queryTokenAuth lets EventSource clients, which cannot set headers, pass the JWT as
+// a "token" query parameter.
+func queryTokenAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetHeader("Authorization") == "" {
+			if token := c.Query("token"); token != "" {
+				c.Request.Header.Set("Authorization", "Bearer "+token)
+			}
+		}
+		c.Next()
+	}
+}
+
+// accessLogFormatter is gin's default log line with the token query parameter
+// replaced, so JWTs passed to the event stream do not end up in the access log.
+func accessLogFormatter(param gin.LogFormatterParams) string {
+	var statusColor, methodColor, resetColor string
+	if param.IsOutputColor() {
+		statusColor = param.StatusCodeColor()
+		methodColor = param.MethodColor()
+		resetColor = param.ResetColor()
+	}
+	if param.Latency > time.Minute {
+		param.Latency = param.Latency.Truncate(time.Second)
+	}
+	return fmt.Sprintf("[GIN] %v |%s %3d %s| %13v | %15s |%s %-7s %s %#v\n%s",
+		param.TimeStamp.Format("2006/01/02 - 15:04:05"),
+		statusColor, param.StatusCode, resetColor,
+		param.Latency,
+		param.ClientIP,
+		methodColor, param.Method, resetColor,
+		redactTokenQuery(param.Path),
+		param.ErrorMessage,
+	)
+}
+
+// redactTokenQuery replaces the token query parameter of a request path.
+func redactTokenQuery(path string) string {
+	u, err := url.Parse(path)
+	if err != nil {
+		return path
+	}
+	query := u.Query()
+	if !query.Has("token") {
+		return path
+	}
+	query.Set("token", "redacted")
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+func streamEvents(c *gin.Context) {
+	events, unsubscribe := realtimeHub.Subscribe(currentUserID(c))
+	defer unsubscribe()
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+
+	heartbeat := time.NewTicker(25 * time.Second)
+	defer heartbeat.Stop()
+
+	c.SSEvent("ready", gin.H{"user_id": currentUserID(c)})
+	c.Writer.Flush()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case event := <-events:
+			if event.Truncated {
+				c.SSEvent(event.Type, gin.H{"truncated": true})
+			} else {
+				c.SSEvent(event.Type, event.Data)
+			}
+			return true
+		case <-heartbeat.C:
+			c.SSEvent("ping", time.Now().Unix())
+			return true
+		}
+	})
+}
+
+// conversationRecipients returns the participants of a conversation other than the sender.
+func conversationRecipients(conversationID, senderID int) []int {
+	rows, err := db.Query(
+		"SELECT user_id FROM conversation_participants WHERE conversation_id = $1 AND user_id <> $2",
+		conversationID, senderID,
+	)
+	if err != nil {
+		log.Printf("Error loading conversation recipients: %v", err)
+		return nil
+	}
+	defer rows.Close()
+
+	var userIDs []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err == nil {
+			userIDs = append(userIDs, id)
+		}
+	}
+	return userIDs
+}
@@ -0,0 +1,506 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// Report schedules deliver a saved report on a cron schedule. The scheduler job
+// stores each run in report_files, so every instance can serve it, and emails the
+// recipients a download link, which works without logging in until the file
+// expires.
+
+type ReportSchedule struct {
+	ID             int        `json:"id" db:"id"`
+	DefinitionID   int        `json:"definition_id" db:"definition_id"`
+	DefinitionName string     `json:"definition_name"`
+	Cron           string     `json:"cron" db:"cron"`
+	Timezone       string     `json:"timezone" db:"timezone"`
+	Recipients     []string   `json:"recipients" db:"recipients"`
+	Format         *string    `json:"format" db:"format"`
+	Active         bool       `json:"active" db:"active"`
+	NextRunAt      *time.Time `json:"next_run_at" db:"next_run_at"`
+	LastRunAt      *time.Time `json:"last_run_at" db:"last_run_at"`
+	LastError      *string    `json:"last_error" db:"last_error"`
+	CreatedBy      *int       `json:"created_by" db:"created_by"`
+	CreatedAt      time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt      *time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// ReportScheduleRequest creates or replaces a schedule. Timezone is an IANA name
+// (UTC by default) the cron expression is evaluated in; Format overrides the
+// definition's format.
+type ReportScheduleRequest struct {
+	DefinitionID int      `json:"definition_id" binding:"required"`
+	Cron         string   `json:"cron" binding:"required"`
+	Timezone     string   `json:"timezone"`
+	Recipients   []string `json:"recipients" binding:"required"`
+	Format       *string  `json:"format"`
+	Active       *bool    `json:"active"`
+}
+
+type ReportFile struct {
+	ID           int       `json:"id" db:"id"`
+	ScheduleID   *int      `json:"schedule_id" db:"schedule_id"`
+	DefinitionID int       `json:"definition_id" db:"definition_id"`
+	Filename     string    `json:"filename" db:"filename"`
+	ContentType  string    `json:"content_type" db:"content_type"`
+	Size         int64     `json:"size" db:"size"`
+	RowCount     int       `json:"row_count" db:"row_count"`
+	URL          string    `json:"url,omitempty"`
+	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+	ExpiresAt    time.Time `json:"expires_at" db:"expires_at"`
+}
+
+const maxReportRecipients = 50
+
+// reportRetention is how long generated report files are kept, from
+// REPORT_RETENTION_DAYS (30 by default).
+func reportRetention() time.Duration {
+	days, err := strconv.Atoi(os.Getenv("REPORT_RETENTION_DAYS"))
+	if err != nil || days < 1 {
+		days = 30
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// apiURL is the public base URL of this API, used in links sent by email.
+func apiURL() string {
+	if url := os.Getenv("API_URL"); url != "" {
+		return url
+	}
+	return "http://localhost:8080"
+}
+
+func reportFileURL(token string) string {
+	return apiURL() + "/api/report-files/" + token
+}
+
+const reportScheduleSelect = `
+	SELECT s.id, s.definition_id, d.name, s.cron, s.timezone, s.recipients, s.format, s.active,
+	       s.next_run_at, s.last_run_at, s.last_error, s.created_by, s.created_at, s.updated_at
+	FROM report_schedules s
+	JOIN report_definitions d ON d.id = s.definition_id
+`
+
+func scanReportSchedule(row interface{ Scan(...interface{}) error }) (ReportSchedule, error) {
+	var s ReportSchedule
+	err := row.Scan(&s.ID, &s.DefinitionID, &s.DefinitionName, &s.Cron, &s.Timezone, pq.Array(&s.Recipients),
+		&s.Format, &s.Active, &s.NextRunAt, &s.LastRunAt, &s.LastError, &s.CreatedBy, &s.CreatedAt, &s.UpdatedAt)
+	return s, err
+}
+
+// nextReportRun returns when a schedule is next due after now, in UTC.
+func nextReportRun(cron, timezone string, now time.Time) (time.Time, error) {
+	schedule, err := parseCron(cron)
+	if err != nil {
+		return time.Time{}, err
+	}
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("unknown timezone: %s", timezone)
+	}
+	next := schedule.Next(now.In(location))
+	if next.IsZero() {
+		return next, fmt.Errorf("cron expression never matches")
+	}
+	return next.UTC(), nil
+}
+
+// validateReportSchedule normalizes the request and returns the first run.
+func validateReportSchedule(req *ReportScheduleRequest) (time.Time, error) {
+	if req.Timezone == "" {
+		req.Timezone = "UTC"
+	}
+	next, err := nextReportRun(req.Cron, req.Timezone, time.Now())
+	if err != nil {
+		return next, err
+	}
+	if len(req.Recipients) == 0 || len(req.Recipients) > maxReportRecipients {
+		return next, fmt.Errorf("recipients must list 1 to %d email addresses", maxReportRecipients)
+	}
+	for i, recipient := range req.Recipients {
+		address, err := mail.ParseAddress(recipient)
+		if err != nil {
+			return next, fmt.Errorf("invalid recipient %q", recipient)
+		}
+		req.Recipients[i] = address.Address
+	}
+	if req.Format != nil {
+		if _, ok := reportFormats[*req.Format]; !ok {
+			return next, fmt.Errorf("format must be one of: csv, xlsx, pdf")
+		}
+	}
+	return next, nil
+}
+
+// loadReportSchedule reads a schedule whose definition is in the caller's tenant,
+// writing the error response when there is none.
+func loadReportSchedule(c *gin.Context, id int) (ReportSchedule, bool) {
+	s, err := scanReportSchedule(db.QueryRow(
+		reportScheduleSelect+" WHERE s.id = $1 AND ($2 = 0 OR d.organization_id = $2)", id, tenantScope(c),
+	))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Report schedule not found"})
+		return s, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return s, false
+	}
+	return s, true
+}
+
+// bindReportSchedule reads and validates a schedule request, checking that its
+// definition is in the caller's tenant.
+func bindReportSchedule(c *gin.Context) (ReportScheduleRequest, time.Time, bool) {
+	var req ReportScheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return req, time.Time{}, false
+	}
+	next, err := validateReportSchedule(&req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return req, next, false
+	}
+	if _, ok := loadReportDefinition(c, req.DefinitionID); !ok {
+		return req, next, false
+	}
+	return req, next, true
+}
+
+func getReportSchedules(c *gin.Context) {
+	rows, err := db.Query(
+		reportScheduleSelect+" WHERE ($1 = 0 OR d.organization_id = $1) ORDER BY d.name, s.id", tenantScope(c),
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	schedules := []ReportSchedule{}
+	for rows.Next() {
+		s, err := scanReportSchedule(rows)
+		if err != nil {
+			continue
+		}
+		schedules = append(schedules, s)
+	}
+
+	c.JSON(http.StatusOK, schedules)
+}
+
+func getReportSchedule(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+	if s, ok := loadReportSchedule(c, id); ok {
+		c.JSON(http.StatusOK, s)
+	}
+}
+
+func createReportSchedule(c *gin.Context) {
+	req, next, ok := bindReportSchedule(c)
+	if !ok {
+		return
+	}
+	active := req.Active == nil || *req.Active
+
+	var id int
+	err := db.QueryRow(`
+		INSERT INTO report_schedules (definition_id, cron, timezone, recipients, format, active, next_run_at, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id
+	`, req.DefinitionID, req.Cron, req.Timezone, pq.Array(req.Recipients), req.Format, active, next,
+		currentUserID(c),
+	).Scan(&id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"id": id, "next_run_at": next, "message": "Report schedule created successfully"})
+}
+
+func updateReportSchedule(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+	if _, ok := loadReportSchedule(c, id); !ok {
+		return
+	}
+	req, next, ok := bindReportSchedule(c)
+	if !ok {
+		return
+	}
+	active := req.Active == nil || *req.Active
+
+	_, err := db.Exec(`
+		UPDATE report_schedules SET definition_id = $1, cron = $2, timezone = $3, recipients = $4, format = $5,
+			active = $6, next_run_at = $7, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $8
+	`, req.DefinitionID, req.Cron, req.Timezone, pq.Array(req.Recipients), req.Format, active, next, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"next_run_at": next, "message": "Report schedule updated successfully"})
+}
+
+// deleteReportSchedule removes the schedule. Files it generated stay available
+// until they expire.
+func deleteReportSchedule(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+	if _, ok := loadReportSchedule(c, id); !ok {
+		return
+	}
+
+	if _, err := db.Exec("DELETE FROM report_schedules WHERE id = $1", id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Report schedule deleted successfully"})
+}
+
+// runReportSchedule delivers a schedule immediately.
+func runReportSchedule(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+	if _, ok := loadReportSchedule(c, id); !ok {
+		return
+	}
+
+	file, err := deliverReportSchedule(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, file)
+}
+
+func getReportScheduleFiles(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+	if _, ok := loadReportSchedule(c, id); !ok {
+		return
+	}
+
+	rows, err := db.Query(`
+		SELECT id, schedule_id, definition_id, filename, content_type, size, row_count, created_at, expires_at
+		FROM report_files
+		WHERE schedule_id = $1 AND expires_at > $2
+		ORDER BY created_at DESC
+	`, id, time.Now().UTC())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	files := []ReportFile{}
+	for rows.Next() {
+		var f ReportFile
+		err := rows.Scan(&f.ID, &f.ScheduleID, &f.DefinitionID, &f.Filename, &f.ContentType, &f.Size, &f.RowCount,
+			&f.CreatedAt, &f.ExpiresAt)
+		if err != nil {
+			continue
+		}
+		files = append(files, f)
+	}
+
+	c.JSON(http.StatusOK, files)
+}
+
+// downloadReportFile serves a generated report. Recipients may not have an
+// account, so the unguessable token in the URL authenticates the request.
+func downloadReportFile(c *gin.Context) {
+	var filename, contentType string
+	var content []byte
+	err := db.QueryRow(
+		"SELECT filename, content_type, content FROM report_files WHERE token_hash = $1 AND expires_at > $2",
+		hashToken(c.Param("token")), time.Now().UTC(),
+	).Scan(&filename, &contentType, &content)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Report not found or expired"})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Data(http.StatusOK, contentType, content)
+}
+
+// generateReportFile renders the report in its format.
+func generateReportFile(d ReportDefinition) (content []byte, rowCount int, err error) {
+	columns, rows, err := queryReport(db, d.Report, d.reportScope())
+	if err != nil {
+		return nil, 0, err
+	}
+	var buf bytes.Buffer
+	rowCount, err = writeReport(&buf, d.Report, columns, rows)
+	if err != nil {
+		return nil, 0, err
+	}
+	return buf.Bytes(), rowCount, nil
+}
+
+// deliverReportSchedule generates the schedule's report, stores the file and emails
+// its link to the recipients. The next run is scheduled whether or not this one
+// succeeds; failures are kept in last_error. A schedule whose next run cannot be
+// computed is deactivated rather than retried every minute.
+func deliverReportSchedule(id int) (ReportFile, error) {
+	var file ReportFile
+	var cron, timezone string
+	var recipients []string
+	var format sql.NullString
+	err := db.QueryRow(
+		"SELECT definition_id, cron, timezone, recipients, format FROM report_schedules WHERE id = $1", id,
+	).Scan(&file.DefinitionID, &cron, &timezone, pq.Array(&recipients), &format)
+	if err != nil {
+		return file, err
+	}
+	now := time.Now().UTC()
+	next, err := nextReportRun(cron, timezone, now)
+	if err != nil {
+		db.Exec(
+			"UPDATE report_schedules SET active = FALSE, last_run_at = $1, last_error = $2 WHERE id = $3",
+			now, err.Error(), id,
+		)
+		return file, err
+	}
+
+	file, err = generateScheduledReport(id, file.DefinitionID, format, recipients, now, next)
+	if err != nil {
+		db.Exec(
+			"UPDATE report_schedules SET last_run_at = $1, next_run_at = $2, last_error = $3 WHERE id = $4",
+			now, next, err.Error(), id,
+		)
+	}
+	return file, err
+}
+
+func generateScheduledReport(scheduleID, definitionID int, format sql.NullString, recipients []string, now, next time.Time) (ReportFile, error) {
+	file := ReportFile{ScheduleID: &scheduleID, DefinitionID: definitionID}
+	d, err := scanReportDefinition(db.QueryRow(reportDefinitionSelect+" WHERE id = $1", definitionID))
+	if err != nil {
+		return file, err
+	}
+	if format.Valid {
+		d.Format = format.String
+	}
+	if err := d.validate(); err != nil {
+		return file, err
+	}
+
+	token, err := generateSecret()
+	if err != nil {
+		return file, err
+	}
+	content, rowCount, err := generateReportFile(d)
+	if err != nil {
+		return file, err
+	}
+	size := int64(len(content))
+	file.Filename = fmt.Sprintf("report-%d-%s.%s", d.ID, now.Format("2006-01-02"), reportFormats[d.Format].extension)
+	file.ContentType = reportFormats[d.Format].contentType
+	file.Size, file.RowCount, file.URL = size, rowCount, reportFileURL(token)
+	file.CreatedAt, file.ExpiresAt = now, now.Add(reportRetention())
+
+	tx, err := db.Begin()
+	if err != nil {
+		return file, err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(`
+		INSERT INTO report_files (schedule_id, definition_id, token_hash, filename, content, content_type, size, row_count,
+			created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING id
+	`, scheduleID, definitionID, hashToken(token), file.Filename, content, file.ContentType, size, rowCount, now, file.ExpiresAt,
+	).Scan(&file.ID)
+	if err == nil {
+		for _, recipient := range recipients {
+			err = enqueueEmail(tx, nil, recipient, "", "report.delivered", "Report: "+d.Name, map[string]interface{}{
+				"report_name": d.Name,
+				"rows":        rowCount,
+				"url":         file.URL,
+				"expires_on":  file.ExpiresAt.Format("January 2, 2006"),
+			})
+			if err != nil {
+				break
+			}
+		}
+	}
+	if err == nil {
+		_, err = tx.Exec(
+			"UPDATE report_schedules SET last_run_at = $1, next_run_at = $2, last_error = NULL WHERE id = $3",
+			now, next, scheduleID,
+		)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	return file, err
+}
+
+// deliverScheduledReports is a scheduler job that delivers the reports that are
+// due. A failing schedule does not hold up the others.
+func deliverScheduledReports() (int, error) {
+	rows, err := db.Query(
+		"SELECT id FROM report_schedules WHERE active AND next_run_at <= $1 ORDER BY next_run_at LIMIT 20",
+		time.Now().UTC(),
+	)
+	if err != nil {
+		return 0, err
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	rows.Close()
+
+	delivered := 0
+	var lastErr error
+	for _, id := range ids {
+		if _, err := deliverReportSchedule(id); err != nil {
+			lastErr = fmt.Errorf("report schedule %d: %v", id, err)
+			continue
+		}
+		delivered++
+	}
+	return delivered, lastErr
+}
+
+// pruneReportFiles is a scheduler job that deletes expired report files.
+func pruneReportFiles() (int, error) {
+	result, err := db.Exec("DELETE FROM report_files WHERE expires_at <= $1", time.Now().UTC())
+	if err != nil {
+		return 0, err
+	}
+	n, _ := result.RowsAffected()
+	return int(n), nil
+}
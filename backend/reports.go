@@ -0,0 +1,637 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// Reports export a source (users, internships, applications or placements) as CSV,
+// XLSX or PDF. Rows are written to the response as they are read, so exports of
+// large tables do not load them into memory. Report definitions save a source,
+// column selection, filters and format under a name for reuse.
+
+type reportColumn struct {
+	Key     string `json:"key"`
+	Label   string `json:"label"`
+	Expr    string `json:"-"`
+	Numeric bool   `json:"numeric"`
+}
+
+// reportSource describes a report's rows. Its expressions are used to build the
+// query: Scope is the organization column, Date the column the date range applies
+// to, and Company and Status the columns of the company_id and status filters.
+type reportSource struct {
+	Name    string         `json:"name"`
+	Title   string         `json:"title"`
+	Columns []reportColumn `json:"columns"`
+	From    string         `json:"-"`
+	Where   string         `json:"-"`
+	Scope   string         `json:"-"`
+	Date    string         `json:"-"`
+	Company string         `json:"-"`
+	Status  string         `json:"-"`
+	Order   string         `json:"-"`
+}
+
+func reportTimestamp(expr string) string {
+	return "to_char(" + expr + ", 'YYYY-MM-DD HH24:MI')"
+}
+
+func reportDate(expr string) string {
+	return "to_char(" + expr + ", 'YYYY-MM-DD')"
+}
+
+var reportSources = []reportSource{
+	{
+		Name:  "users",
+		Title: "Users",
+		Columns: []reportColumn{
+			{Key: "id", Label: "ID", Expr: "u.id", Numeric: true},
+			{Key: "name", Label: "Name", Expr: "u.name"},
+			{Key: "email", Label: "Email", Expr: "u.email"},
+			{Key: "role", Label: "Role", Expr: "u.role"},
+			{Key: "department", Label: "Department", Expr: "u.department"},
+			{Key: "company", Label: "Company", Expr: "COALESCE(co.name, u.company)"},
+			{Key: "organization", Label: "Organization", Expr: "o.name"},
+			{Key: "created_at", Label: "Created", Expr: reportTimestamp("u.created_at")},
+		},
+		From: `
+			FROM users u
+			LEFT JOIN companies co ON co.id = u.company_id
+			LEFT JOIN organizations o ON o.id = u.organization_id`,
+		Scope:   "u.organization_id",
+		Date:    "u.created_at",
+		Company: "u.company_id",
+		Status:  "u.role",
+		Order:   "u.id",
+	},
+	{
+		Name:  "internships",
+		Title: "Internships",
+		Columns: []reportColumn{
+			{Key: "id", Label: "ID", Expr: "i.id", Numeric: true},
+			{Key: "title", Label: "Title", Expr: "i.title"},
+			{Key: "company", Label: "Company", Expr: "COALESCE(co.name, i.company)"},
+			{Key: "mentor", Label: "Mentor", Expr: "i.mentor_name"},
+			{Key: "location", Label: "Location", Expr: "i.location"},
+			{Key: "type", Label: "Type", Expr: "i.type"},
+			{Key: "status", Label: "Status", Expr: "i.status"},
+			{Key: "posted_date", Label: "Posted", Expr: reportDate("i.posted_date")},
+			{Key: "deadline", Label: "Deadline", Expr: reportDate("i.deadline")},
+			{Key: "start_date", Label: "Start", Expr: reportDate("i.start_date")},
+			{Key: "end_date", Label: "End", Expr: reportDate("i.end_date")},
+			{Key: "duration_weeks", Label: "Weeks", Expr: "i.duration_weeks", Numeric: true},
+			{Key: "salary_min", Label: "Salary min", Expr: "i.salary_min", Numeric: true},
+			{Key: "salary_max", Label: "Salary max", Expr: "i.salary_max", Numeric: true},
+			{Key: "salary_currency", Label: "Currency", Expr: "i.salary_currency"},
+			{Key: "salary_period", Label: "Salary period", Expr: "i.salary_period"},
+			{Key: "max_students", Label: "Places", Expr: "i.max_students", Numeric: true},
+			{Key: "applications", Label: "Applications", Numeric: true,
+				Expr: "(SELECT COUNT(*) FROM applications a WHERE a.internship_id = i.id)"},
+			{Key: "accepted", Label: "Accepted", Numeric: true,
+				Expr: "(SELECT COUNT(*) FROM applications a WHERE a.internship_id = i.id AND a.status = 'accepted')"},
+		},
+		From: `
+			FROM internships i
+			LEFT JOIN companies co ON co.id = i.company_id`,
+		Scope:   "i.organization_id",
+		Date:    "i.posted_date",
+		Company: "i.company_id",
+		Status:  "i.status",
+		Order:   "i.id",
+	},
+	{
+		Name:  "applications",
+		Title: "Applications",
+		Columns: []reportColumn{
+			{Key: "id", Label: "ID", Expr: "a.id", Numeric: true},
+			{Key: "student", Label: "Student", Expr: "a.student_name"},
+			{Key: "student_email", Label: "Email", Expr: "s.email"},
+			{Key: "internship_id", Label: "Internship ID", Expr: "i.id", Numeric: true},
+			{Key: "internship", Label: "Internship", Expr: "i.title"},
+			{Key: "company", Label: "Company", Expr: "COALESCE(co.name, i.company)"},
+			{Key: "status", Label: "Status", Expr: "a.status"},
+			{Key: "applied_date", Label: "Applied", Expr: reportTimestamp("a.applied_date")},
+			{Key: "decided_at", Label: "Decided", Expr: `(SELECT ` + reportTimestamp("MIN(h.changed_at)") + `
+				FROM application_status_history h WHERE h.application_id = a.id AND h.status IN ('accepted', 'rejected'))`},
+		},
+		From: `
+			FROM applications a
+			JOIN internships i ON i.id = a.internship_id
+			JOIN users s ON s.id = a.student_id
+			LEFT JOIN companies co ON co.id = i.company_id`,
+		Scope:   "i.organization_id",
+		Date:    "a.applied_date",
+		Company: "i.company_id",
+		Status:  "a.status",
+		Order:   "a.id",
+	},
+	{
+		// Placements are accepted applications; their status is the outcome
+		Name:  "placements",
+		Title: "Placement Outcomes",
+		Columns: []reportColumn{
+			{Key: "application_id", Label: "Application ID", Expr: "a.id", Numeric: true},
+			{Key: "student", Label: "Student", Expr: "a.student_name"},
+			{Key: "student_email", Label: "Email", Expr: "s.email"},
+			{Key: "department", Label: "Department", Expr: "s.department"},
+			{Key: "internship", Label: "Internship", Expr: "i.title"},
+			{Key: "company", Label: "Company", Expr: "COALESCE(co.name, i.company)"},
+			{Key: "mentor", Label: "Mentor", Expr: "i.mentor_name"},
+			{Key: "location", Label: "Location", Expr: "i.location"},
+			{Key: "start_date", Label: "Start", Expr: reportDate("i.start_date")},
+			{Key: "end_date", Label: "End", Expr: reportDate("i.end_date")},
+			{Key: "accepted_at", Label: "Accepted", Expr: `(SELECT ` + reportTimestamp("MIN(h.changed_at)") + `
+				FROM application_status_history h WHERE h.application_id = a.id AND h.status = 'accepted')`},
+			{Key: "hours_approved", Label: "Approved hours", Numeric: true,
+				Expr: "(SELECT COALESCE(SUM(t.hours), 0) FROM timesheets t WHERE t.application_id = a.id AND t.status = 'approved')"},
+			{Key: "outcome", Label: "Outcome", Expr: placementOutcome},
+		},
+		From: `
+			FROM applications a
+			JOIN internships i ON i.id = a.internship_id
+			JOIN users s ON s.id = a.student_id
+			LEFT JOIN companies co ON co.id = i.company_id`,
+		Where:   "a.status = 'accepted'",
+		Scope:   "i.organization_id",
+		Date:    "i.start_date",
+		Company: "i.company_id",
+		Status:  placementOutcome,
+		Order:   "i.start_date NULLS LAST, a.id",
+	},
+}
+
+// placementOutcome is upcoming, in_progress or completed depending on the
+// internship's dates.
+const placementOutcome = `(CASE WHEN i.end_date < CURRENT_DATE THEN 'completed'
+	WHEN i.start_date <= CURRENT_DATE THEN 'in_progress' ELSE 'upcoming' END)`
+
+func findReportSource(name string) (reportSource, bool) {
+	for _, source := range reportSources {
+		if source.Name == name {
+			return source, true
+		}
+	}
+	return reportSource{}, false
+}
+
+var reportFormats = map[string]struct{ contentType, extension string }{
+	"csv":  {"text/csv; charset=utf-8", "csv"},
+	"xlsx": {"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", "xlsx"},
+	"pdf":  {"application/pdf", "pdf"},
+}
+
+// ReportFilters narrow a report's rows. From and To (YYYY-MM-DD, inclusive) apply
+// to the source's date; Status is the role for users and the outcome for
+// placements.
+type ReportFilters struct {
+	From      string `json:"from,omitempty"`
+	To        string `json:"to,omitempty"`
+	CompanyID int    `json:"company_id,omitempty"`
+	Status    string `json:"status,omitempty"`
+}
+
+// Report selects what to export. Columns default to all of the source's columns and
+// Format to csv.
+type Report struct {
+	Source  string        `json:"source" binding:"required"`
+	Columns []string      `json:"columns"`
+	Filters ReportFilters `json:"filters"`
+	Format  string        `json:"format"`
+}
+
+type ReportDefinition struct {
+	ID   int    `json:"id" db:"id"`
+	Name string `json:"name" db:"name"`
+	Report
+	CreatedBy      *int       `json:"created_by" db:"created_by"`
+	OrganizationID *int       `json:"organization_id" db:"organization_id"`
+	CreatedAt      time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt      *time.Time `json:"updated_at" db:"updated_at"`
+}
+
+type ReportDefinitionRequest struct {
+	Name string `json:"name" binding:"required"`
+	Report
+}
+
+// validate checks the report and fills in the default columns and format.
+func (r *Report) validate() error {
+	source, ok := findReportSource(r.Source)
+	if !ok {
+		return fmt.Errorf("unknown report source: %s", r.Source)
+	}
+	if r.Format == "" {
+		r.Format = "csv"
+	}
+	if _, ok := reportFormats[r.Format]; !ok {
+		return fmt.Errorf("format must be one of: csv, xlsx, pdf")
+	}
+	if len(r.Columns) == 0 {
+		for _, column := range source.Columns {
+			r.Columns = append(r.Columns, column.Key)
+		}
+	}
+	for _, key := range r.Columns {
+		if _, ok := source.column(key); !ok {
+			return fmt.Errorf("unknown %s column: %s", source.Name, key)
+		}
+	}
+	for field, date := range map[string]string{"from": r.Filters.From, "to": r.Filters.To} {
+		if date == "" {
+			continue
+		}
+		if err := validateDate(field, &date); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s reportSource) column(key string) (reportColumn, bool) {
+	for _, column := range s.Columns {
+		if column.Key == key {
+			return column, true
+		}
+	}
+	return reportColumn{}, false
+}
+
+// queryReport runs a validated report in the tenant scope, returning its columns
+// and the open rows.
+func queryReport(q sqlQueryer, r Report, scope int) ([]reportColumn, *sql.Rows, error) {
+	source, _ := findReportSource(r.Source)
+	columns := make([]reportColumn, len(r.Columns))
+	exprs := make([]string, len(r.Columns))
+	for i, key := range r.Columns {
+		columns[i], _ = source.column(key)
+		exprs[i] = columns[i].Expr
+	}
+
+	query := "SELECT " + strings.Join(exprs, ", ") + source.From + `
+		WHERE ($1 = 0 OR ` + source.Scope + ` = $1)
+		  AND (NULLIF($2, '') IS NULL OR ` + source.Date + ` >= NULLIF($2, '')::date)
+		  AND (NULLIF($3, '') IS NULL OR ` + source.Date + ` < NULLIF($3, '')::date + 1)
+		  AND ($4 = 0 OR ` + source.Company + ` = $4)
+		  AND ($5 = '' OR ` + source.Status + ` = $5)`
+	if source.Where != "" {
+		query += " AND " + source.Where
+	}
+	query += " ORDER BY " + source.Order
+
+	f := r.Filters
+	rows, err := q.Query(query, scope, f.From, f.To, f.CompanyID, f.Status)
+	return columns, rows, err
+}
+
+// reportWriter writes report rows in one of the export formats.
+type reportWriter interface {
+	WriteRow(values []sql.NullString, header bool) error
+	Close() error
+}
+
+// spreadsheetText keeps spreadsheet programs from reading text as a formula by
+// prefixing values that start with a formula character with a quote.
+func spreadsheetText(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+type csvReportWriter struct {
+	w       *csv.Writer
+	columns []reportColumn
+}
+
+func (r csvReportWriter) WriteRow(values []sql.NullString, header bool) error {
+	record := make([]string, len(values))
+	for i, v := range values {
+		record[i] = v.String
+		if header || !r.columns[i].Numeric {
+			record[i] = spreadsheetText(v.String)
+		}
+	}
+	return r.w.Write(record)
+}
+
+func (r csvReportWriter) Close() error {
+	r.w.Flush()
+	return r.w.Error()
+}
+
+type xlsxReportWriter struct {
+	x       *XLSXWriter
+	columns []reportColumn
+}
+
+func (r xlsxReportWriter) WriteRow(values []sql.NullString, header bool) error {
+	cells := make([]XLSXCell, len(values))
+	for i, v := range values {
+		cells[i] = XLSXCell{Value: v.String, Number: !header && r.columns[i].Numeric}
+	}
+	return r.x.WriteRow(cells, header)
+}
+
+func (r xlsxReportWriter) Close() error {
+	return r.x.Close()
+}
+
+type pdfReportWriter struct {
+	p *PDFWriter
+}
+
+func (r pdfReportWriter) WriteRow(values []sql.NullString, header bool) error {
+	cells := make([]string, len(values))
+	for i, v := range values {
+		cells[i] = v.String
+	}
+	r.p.TableRow(cells, header, 8)
+	return r.p.err
+}
+
+func (r pdfReportWriter) Close() error {
+	return r.p.Close()
+}
+
+// writeReport writes the rows of a report in its format, closing the rows.
+func writeReport(w io.Writer, r Report, columns []reportColumn, rows *sql.Rows) (int, error) {
+	defer rows.Close()
+
+	source, _ := findReportSource(r.Source)
+	var out reportWriter
+	switch r.Format {
+	case "xlsx":
+		out = xlsxReportWriter{x: NewXLSXWriter(w, source.Title), columns: columns}
+	case "pdf":
+		p := NewPDFWriter(w)
+		p.Heading(source.Title, 16)
+		p.Paragraph("Generated "+time.Now().Format("January 2, 2006 15:04"), 9)
+		p.Space(6)
+		out = pdfReportWriter{p: p}
+	default:
+		out = csvReportWriter{w: csv.NewWriter(w), columns: columns}
+	}
+
+	values := make([]sql.NullString, len(columns))
+	for i, column := range columns {
+		values[i] = sql.NullString{String: column.Label, Valid: true}
+	}
+	if err := out.WriteRow(values, true); err != nil {
+		return 0, err
+	}
+
+	dest := make([]interface{}, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	count := 0
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return count, err
+		}
+		if err := out.WriteRow(values, false); err != nil {
+			return count, err
+		}
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		return count, err
+	}
+	return count, out.Close()
+}
+
+// streamReport sends a validated report as a download. Errors after the first byte
+// can only be logged; the client sees a truncated file.
+func streamReport(c *gin.Context, r Report, filename string, scope int) {
+	columns, rows, err := queryReport(db, r, scope)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	format := reportFormats[r.Format]
+	c.Header("Content-Type", format.contentType)
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-%s.%s"`,
+		filename, time.Now().Format("2006-01-02"), format.extension))
+	c.Status(http.StatusOK)
+	if _, err := writeReport(c.Writer, r, columns, rows); err != nil {
+		log.Printf("Error streaming %s report: %v", r.Source, err)
+	}
+}
+
+func getReportSources(c *gin.Context) {
+	c.JSON(http.StatusOK, reportSources)
+}
+
+// exportReport streams a report of the source in the path, with columns (comma
+// separated), format and filters from the query string.
+func exportReport(c *gin.Context) {
+	r := Report{Source: c.Param("source"), Format: c.Query("format")}
+	if columns := c.Query("columns"); columns != "" {
+		for _, key := range strings.Split(columns, ",") {
+			r.Columns = append(r.Columns, strings.TrimSpace(key))
+		}
+	}
+	r.Filters.From, r.Filters.To = c.Query("from"), c.Query("to")
+	r.Filters.CompanyID, _ = strconv.Atoi(c.Query("company_id"))
+	r.Filters.Status = c.Query("status")
+	if err := r.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	streamReport(c, r, r.Source, tenantScope(c))
+}
+
+const reportDefinitionSelect = `
+	SELECT id, name, source, columns, filters, format, created_by, organization_id, created_at, updated_at
+	FROM report_definitions
+`
+
+func scanReportDefinition(row interface{ Scan(...interface{}) error }) (ReportDefinition, error) {
+	var d ReportDefinition
+	var filters []byte
+	err := row.Scan(&d.ID, &d.Name, &d.Source, pq.Array(&d.Columns), &filters, &d.Format, &d.CreatedBy,
+		&d.OrganizationID, &d.CreatedAt, &d.UpdatedAt)
+	if err != nil {
+		return d, err
+	}
+	err = json.Unmarshal(filters, &d.Filters)
+	return d, err
+}
+
+// reportScope is the tenant scope a saved definition runs in: its organization, or
+// every organization for definitions saved by global admins without one.
+func (d ReportDefinition) reportScope() int {
+	if d.OrganizationID == nil {
+		return 0
+	}
+	return *d.OrganizationID
+}
+
+// loadReportDefinition reads a definition in the caller's tenant, writing the error
+// response when there is none.
+func loadReportDefinition(c *gin.Context, id int) (ReportDefinition, bool) {
+	d, err := scanReportDefinition(db.QueryRow(
+		reportDefinitionSelect+" WHERE id = $1 AND ($2 = 0 OR organization_id = $2)", id, tenantScope(c),
+	))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Report definition not found"})
+		return d, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return d, false
+	}
+	return d, true
+}
+
+func getReportDefinitions(c *gin.Context) {
+	rows, err := db.Query(
+		reportDefinitionSelect+" WHERE ($1 = 0 OR organization_id = $1) ORDER BY name", tenantScope(c),
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	definitions := []ReportDefinition{}
+	for rows.Next() {
+		d, err := scanReportDefinition(rows)
+		if err != nil {
+			continue
+		}
+		definitions = append(definitions, d)
+	}
+
+	c.JSON(http.StatusOK, definitions)
+}
+
+func getReportDefinition(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+	if d, ok := loadReportDefinition(c, id); ok {
+		c.JSON(http.StatusOK, d)
+	}
+}
+
+// bindReportDefinition reads and validates a definition request.
+func bindReportDefinition(c *gin.Context) (ReportDefinitionRequest, []byte, bool) {
+	var req ReportDefinitionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return req, nil, false
+	}
+	if err := req.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return req, nil, false
+	}
+	filters, err := json.Marshal(req.Filters)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return req, nil, false
+	}
+	return req, filters, true
+}
+
+// createReportDefinition saves a definition in the caller's tenant; global admins
+// without an organization_id filter save definitions across organizations.
+func createReportDefinition(c *gin.Context) {
+	req, filters, ok := bindReportDefinition(c)
+	if !ok {
+		return
+	}
+	var organizationID *int
+	if scope := tenantScope(c); scope > 0 {
+		organizationID = &scope
+	}
+
+	var id int
+	err := db.QueryRow(`
+		INSERT INTO report_definitions (name, source, columns, filters, format, created_by, organization_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id
+	`, req.Name, req.Source, pq.Array(req.Columns), filters, req.Format, currentUserID(c), organizationID).Scan(&id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"id": id, "message": "Report definition created successfully"})
+}
+
+func updateReportDefinition(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+	req, filters, ok := bindReportDefinition(c)
+	if !ok {
+		return
+	}
+	if _, ok := loadReportDefinition(c, id); !ok {
+		return
+	}
+
+	_, err := db.Exec(`
+		UPDATE report_definitions SET name = $1, source = $2, columns = $3, filters = $4, format = $5,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = $6
+	`, req.Name, req.Source, pq.Array(req.Columns), filters, req.Format, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Report definition updated successfully"})
+}
+
+func deleteReportDefinition(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+	if _, ok := loadReportDefinition(c, id); !ok {
+		return
+	}
+
+	if _, err := db.Exec("DELETE FROM report_definitions WHERE id = $1", id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Report definition deleted successfully"})
+}
+
+// exportReportDefinition streams a saved report, optionally in another format.
+func exportReportDefinition(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+	d, ok := loadReportDefinition(c, id)
+	if !ok {
+		return
+	}
+	if format := c.Query("format"); format != "" {
+		d.Format = format
+	}
+	if err := d.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	streamReport(c, d.Report, fmt.Sprintf("report-%d", d.ID), d.reportScope())
+}
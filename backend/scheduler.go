@@ -0,0 +1,304 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Job is a periodic background task. Run returns the number of records it changed,
+// which is stored with the job run.
+type Job struct {
+	Name     string
+	Interval time.Duration
+	Run      func() (int, error)
+}
+
+type JobRun struct {
+	ID         int        `json:"id" db:"id"`
+	JobName    string     `json:"job_name" db:"job_name"`
+	Instance   string     `json:"instance" db:"instance"`
+	Status     string     `json:"status" db:"status"`
+	Affected   int        `json:"affected" db:"affected"`
+	Error      *string    `json:"error" db:"error"`
+	StartedAt  time.Time  `json:"started_at" db:"started_at"`
+	FinishedAt *time.Time `json:"finished_at" db:"finished_at"`
+}
+
+// jobRunRetention is how long job runs are kept.
+const jobRunRetention = 30 * 24 * time.Hour
+
+// scheduledJobs lists the jobs run by the scheduler.
+var scheduledJobs = []Job{
+	{Name: "close_expired_internships", Interval: 5 * time.Minute, Run: closeExpiredInternships},
+	{Name: "publish_scheduled_internships", Interval: time.Minute, Run: publishScheduledInternships},
+	{Name: "deadline_reminders", Interval: time.Hour, Run: sendDeadlineReminders},
+	{Name: "evaluation_reminders", Interval: time.Hour, Run: sendEvaluationReminders},
+	{Name: "saved_search_alerts", Interval: 15 * time.Minute, Run: sendSavedSearchAlerts},
+	{Name: "geocode_internships", Interval: time.Hour, Run: geocodeInternships},
+	{Name: "deliver_scheduled_reports", Interval: time.Minute, Run: deliverScheduledReports},
+	{Name: "prune_report_files", Interval: 24 * time.Hour, Run: pruneReportFiles},
+	{Name: "prune_job_runs", Interval: 24 * time.Hour, Run: pruneJobRuns},
+}
+
+// schedulerInstance identifies this process in job runs.
+var schedulerInstance = func() string {
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%s:%d", host, os.Getpid())
+}()
+
+// startScheduler runs every job on its interval. Each instance of the server runs the
+// scheduler; a Postgres advisory lock makes sure only one of them runs a job at a
+// time, and a job that already succeeded within its interval on another instance is
+// skipped.
+func startScheduler(jobs []Job) {
+	for _, job := range jobs {
+		go func(job Job) {
+			for {
+				if _, err := runJob(job, false); err != nil {
+					log.Printf("Job %s failed: %v", job.Name, err)
+				}
+				time.Sleep(job.Interval)
+			}
+		}(job)
+	}
+}
+
+func jobLockKey(name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte("lms-job:" + name))
+	return int64(h.Sum64())
+}
+
+// runJob runs the job under its advisory lock and records the run. It returns false
+// when the job was skipped because another instance holds the lock or recently ran
+// it; force ignores the latter.
+func runJob(job Job, force bool) (bool, error) {
+	ctx := context.Background()
+
+	// Session advisory locks belong to a connection, so lock and unlock on one
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	var locked bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", jobLockKey(job.Name)).Scan(&locked); err != nil {
+		return false, err
+	}
+	if !locked {
+		return false, nil
+	}
+	defer conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", jobLockKey(job.Name))
+
+	if !force {
+		// Allow some slack so instances started a little apart do not skip each other's turn
+		var recent bool
+		err := conn.QueryRowContext(ctx, `
+			SELECT EXISTS (
+				SELECT 1 FROM job_runs
+				WHERE job_name = $1 AND status = 'succeeded'
+				  AND started_at > CURRENT_TIMESTAMP - $2 * INTERVAL '1 second'
+			)
+		`, job.Name, (job.Interval * 9 / 10).Seconds()).Scan(&recent)
+		if err != nil {
+			return false, err
+		}
+		if recent {
+			return false, nil
+		}
+	}
+
+	var runID int
+	err = conn.QueryRowContext(ctx,
+		"INSERT INTO job_runs (job_name, instance) VALUES ($1, $2) RETURNING id",
+		job.Name, schedulerInstance,
+	).Scan(&runID)
+	if err != nil {
+		return false, err
+	}
+
+	affected, runErr := safeRun(job)
+	status, message := "succeeded", sql.NullString{}
+	if runErr != nil {
+		status, message = "failed", sql.NullString{String: runErr.Error(), Valid: true}
+	}
+	_, err = conn.ExecContext(ctx, `
+		UPDATE job_runs SET status = $1, affected = $2, error = $3, finished_at = CURRENT_TIMESTAMP WHERE id = $4
+	`, status, affected, message, runID)
+	if runErr != nil {
+		return true, runErr
+	}
+	return true, err
+}
+
+// safeRun turns a panicking job into a failed run.
+func safeRun(job Job) (affected int, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return job.Run()
+}
+
+// closeExpiredInternships closes active internships whose deadline has passed.
+func closeExpiredInternships() (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`
+		UPDATE internships SET status = 'closed'
+		WHERE status = 'active' AND deadline < CURRENT_TIMESTAMP
+		RETURNING id, title, mentor_id
+	`)
+	if err != nil {
+		return 0, err
+	}
+	var events []DomainEvent
+	for rows.Next() {
+		var id, mentorID int
+		var title string
+		if err := rows.Scan(&id, &title, &mentorID); err != nil {
+			continue
+		}
+		events = append(events, DomainEvent{
+			Type:       EventInternshipClosed,
+			Recipients: []int{mentorID},
+			Data:       map[string]interface{}{"internship_id": id, "internship_title": title},
+		})
+	}
+	rows.Close()
+
+	for _, event := range events {
+		if err := dispatchEvent(tx, event); err != nil {
+			return 0, err
+		}
+	}
+	return len(events), tx.Commit()
+}
+
+// publishScheduledInternships publishes drafts whose publish_at time has come.
+// Drafts whose deadline passed before they were published are closed instead;
+// they were never live, so no events are sent for them.
+func publishScheduledInternships() (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		UPDATE internships SET status = 'closed', publish_at = NULL
+		WHERE status = 'draft' AND publish_at <= CURRENT_TIMESTAMP AND deadline < CURRENT_TIMESTAMP
+	`)
+	if err != nil {
+		return 0, err
+	}
+
+	rows, err := tx.Query(`
+		UPDATE internships SET status = 'active', publish_at = NULL, published_at = CURRENT_TIMESTAMP
+		WHERE status = 'draft' AND publish_at <= CURRENT_TIMESTAMP AND deadline >= CURRENT_TIMESTAMP
+		RETURNING id, title, mentor_id
+	`)
+	if err != nil {
+		return 0, err
+	}
+	var events []DomainEvent
+	for rows.Next() {
+		var id, mentorID int
+		var title string
+		if err := rows.Scan(&id, &title, &mentorID); err != nil {
+			continue
+		}
+		events = append(events, DomainEvent{
+			Type:       EventInternshipPublished,
+			Recipients: []int{mentorID},
+			Data:       map[string]interface{}{"internship_id": id, "internship_title": title},
+		})
+	}
+	rows.Close()
+
+	for _, event := range events {
+		if err := dispatchEvent(tx, event); err != nil {
+			return 0, err
+		}
+	}
+	return len(events), tx.Commit()
+}
+
+func pruneJobRuns() (int, error) {
+	result, err := db.Exec(
+		"DELETE FROM job_runs WHERE started_at < CURRENT_TIMESTAMP - $1 * INTERVAL '1 second'",
+		jobRunRetention.Seconds(),
+	)
+	if err != nil {
+		return 0, err
+	}
+	n, _ := result.RowsAffected()
+	return int(n), nil
+}
+
+func getJobRuns(c *gin.Context) {
+	limit := 100
+	if l, err := strconv.Atoi(c.Query("limit")); err == nil && l > 0 && l <= 500 {
+		limit = l
+	}
+
+	rows, err := db.Query(`
+		SELECT id, job_name, instance, status, affected, error, started_at, finished_at FROM job_runs
+		WHERE ($1 = '' OR job_name = $1) AND ($2 = '' OR status = $2)
+		ORDER BY started_at DESC, id DESC
+		LIMIT $3
+	`, c.Query("job"), c.Query("status"), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	runs := []JobRun{}
+	for rows.Next() {
+		var r JobRun
+		if err := rows.Scan(&r.ID, &r.JobName, &r.Instance, &r.Status, &r.Affected, &r.Error, &r.StartedAt, &r.FinishedAt); err != nil {
+			continue
+		}
+		runs = append(runs, r)
+	}
+
+	c.JSON(http.StatusOK, runs)
+}
+
+// triggerJob runs a job immediately, unless another instance is running it.
+func triggerJob(c *gin.Context) {
+	name := c.Param("name")
+	for _, job := range scheduledJobs {
+		if job.Name != name {
+			continue
+		}
+		ran, err := runJob(job, true)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if !ran {
+			c.JSON(http.StatusConflict, gin.H{"error": "Job is already running"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Job completed"})
+		return
+	}
+	c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// InternshipFilter holds the filters of the internship list endpoint. Saved searches
+// store it as JSON, so fields must keep their names once released.
+type InternshipFilter struct {
+	Query        string   `json:"q,omitempty"`
+	Type         string   `json:"type,omitempty"`
+	Location     string   `json:"location,omitempty"`
+	Tags         []string `json:"tags,omitempty"`
+	CompanyID    int      `json:"company_id,omitempty"`
+	Status       string   `json:"status,omitempty"`
+	VerifiedOnly bool     `json:"verified_only,omitempty"`
+	MinWeeks     int      `json:"min_weeks,omitempty"`
+	MaxWeeks     int      `json:"max_weeks,omitempty"`
+	City         string   `json:"city,omitempty"`
+	Region       string   `json:"region,omitempty"`
+	Country      string   `json:"country,omitempty"`
+	// Salary bounds compare amounts as stored, so combine them with SalaryPeriod and
+	// SalaryCurrency
+	MinSalary      float64 `json:"min_salary,omitempty"`
+	MaxSalary      float64 `json:"max_salary,omitempty"`
+	SalaryCurrency string  `json:"salary_currency,omitempty"`
+	SalaryPeriod   string  `json:"salary_period,omitempty"`
+	StartFrom      string  `json:"start_from,omitempty"`
+	StartTo        string  `json:"start_to,omitempty"`
+	Sort           string  `json:"sort,omitempty"`
+	// Near is a place name resolved to NearLat and NearLng by locate. RadiusKm
+	// limits results to that distance from the point.
+	Near     string   `json:"near,omitempty"`
+	NearLat  *float64 `json:"near_lat,omitempty"`
+	NearLng  *float64 `json:"near_lng,omitempty"`
+	RadiusKm float64  `json:"radius_km,omitempty"`
+	// BBox is min_lng, min_lat, max_lng, max_lat, as in GeoJSON
+	BBox []float64 `json:"bbox,omitempty"`
+}
+
+// internshipDistance is the distance in kilometres between an internship and the
+// point ($20, $21).
+const internshipDistance = `(2 * 6371 * asin(LEAST(1, sqrt(
+		power(sin(radians(i.latitude - $20::float8) / 2), 2) +
+		cos(radians($20::float8)) * cos(radians(i.latitude)) * power(sin(radians(i.longitude - $21::float8) / 2), 2)))))`
+
+// internshipSorts maps the sort parameter to ORDER BY clauses. The default is newest
+// first.
+var internshipSorts = map[string]string{
+	"newest":     "i.posted_date DESC, i.id DESC",
+	"deadline":   "i.deadline ASC, i.id DESC",
+	"salary":     "COALESCE(i.salary_max, i.salary_min) DESC NULLS LAST, i.id DESC",
+	"duration":   "i.duration_weeks ASC NULLS LAST, i.id DESC",
+	"start_date": "i.start_date ASC NULLS LAST, i.id DESC",
+	"distance":   internshipDistance + " ASC NULLS LAST, i.id DESC",
+}
+
+// internshipFilterClause applies an InternshipFilter. Drafts are only listed for
+// their mentor, $27. Its parameters are produced by InternshipFilter.args; callers
+// add their own parameters from $28 on.
+const internshipFilterClause = `
+		($1 = 0 OR i.organization_id = $1)
+		AND ($2 = '' OR i.title ILIKE '%' || $2 || '%' OR i.description ILIKE '%' || $2 || '%' OR i.company ILIKE '%' || $2 || '%')
+		AND ($3 = '' OR i.type = $3)
+		AND ($4 = '' OR i.location ILIKE '%' || $4 || '%')
+		AND (cardinality($5::text[]) = 0 OR EXISTS (SELECT 1 FROM unnest(COALESCE(i.tags, '{}')) t WHERE lower(t) = ANY($5)))
+		AND ($6 = 0 OR i.company_id = $6)
+		AND ($7 = '' OR i.status = $7)
+		AND (NOT $8 OR EXISTS (SELECT 1 FROM companies co WHERE co.id = i.company_id AND co.verification_status = 'verified'))
+		AND ($9 = 0 OR i.duration_weeks >= $9)
+		AND ($10 = 0 OR i.duration_weeks <= $10)
+		AND ($11 = '' OR lower(i.city) = lower($11))
+		AND ($12 = '' OR lower(i.region) = lower($12))
+		AND ($13 = '' OR i.country = $13)
+		AND ($14::numeric = 0 OR COALESCE(i.salary_max, i.salary_min) >= $14::numeric)
+		AND ($15::numeric = 0 OR COALESCE(i.salary_min, i.salary_max) <= $15::numeric)
+		AND ($16 = '' OR i.salary_currency = upper($16))
+		AND ($17 = '' OR i.salary_period = $17)
+		AND (NULLIF($18, '') IS NULL OR i.start_date >= NULLIF($18, '')::date)
+		AND (NULLIF($19, '') IS NULL OR i.start_date <= NULLIF($19, '')::date)
+		AND ($22::float8 IS NULL OR (
+			i.latitude BETWEEN $20::float8 - $22::float8 / 111.0 AND $20::float8 + $22::float8 / 111.0
+			AND ` + internshipDistance + ` <= $22::float8))
+		AND ($23::float8 IS NULL OR (
+			i.latitude BETWEEN $23::float8 AND $25::float8
+			AND CASE WHEN $24::float8 <= $26::float8 THEN i.longitude BETWEEN $24::float8 AND $26::float8
+			         ELSE i.longitude >= $24::float8 OR i.longitude <= $26::float8 END))
+		AND (i.status <> 'draft' OR i.mentor_id = $27)`
+
+// parseInternshipFilter reads the filter from query parameters. Tags are
+// comma-separated.
+func parseInternshipFilter(c *gin.Context) InternshipFilter {
+	f := InternshipFilter{
+		Query:        strings.TrimSpace(c.Query("q")),
+		Type:         c.Query("type"),
+		Location:     strings.TrimSpace(c.Query("location")),
+		Status:       c.Query("status"),
+		VerifiedOnly: c.Query("verified_only") == "true",
+	}
+	f.CompanyID, _ = strconv.Atoi(c.Query("company_id"))
+	f.MinWeeks, _ = strconv.Atoi(c.Query("min_weeks"))
+	f.MaxWeeks, _ = strconv.Atoi(c.Query("max_weeks"))
+	f.City = strings.TrimSpace(c.Query("city"))
+	f.Region = strings.TrimSpace(c.Query("region"))
+	f.Country = strings.TrimSpace(c.Query("country"))
+	f.MinSalary, _ = strconv.ParseFloat(c.Query("min_salary"), 64)
+	f.MaxSalary, _ = strconv.ParseFloat(c.Query("max_salary"), 64)
+	f.SalaryCurrency = c.Query("salary_currency")
+	f.SalaryPeriod = c.Query("salary_period")
+	f.StartFrom = c.Query("start_from")
+	f.StartTo = c.Query("start_to")
+	f.Sort = c.Query("sort")
+	f.Near = strings.TrimSpace(c.Query("near"))
+	if lat, err := strconv.ParseFloat(c.Query("near_lat"), 64); err == nil {
+		f.NearLat = &lat
+	}
+	if lng, err := strconv.ParseFloat(c.Query("near_lng"), 64); err == nil {
+		f.NearLng = &lng
+	}
+	f.RadiusKm, _ = strconv.ParseFloat(c.Query("radius_km"), 64)
+	if bbox := c.Query("bbox"); bbox != "" {
+		for _, v := range strings.Split(bbox, ",") {
+			n, _ := strconv.ParseFloat(strings.TrimSpace(v), 64)
+			f.BBox = append(f.BBox, n)
+		}
+	}
+	for _, tag := range strings.Split(c.Query("tags"), ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			f.Tags = append(f.Tags, tag)
+		}
+	}
+	return f
+}
+
+// args returns the parameters of internshipFilterClause for the given tenant scope
+// and viewer.
+func (f InternshipFilter) args(scope, viewerID int) []interface{} {
+	tags := make([]string, len(f.Tags))
+	for i, tag := range f.Tags {
+		tags[i] = strings.ToLower(tag)
+	}
+	country := f.Country
+	if code, ok := countryCode(country); ok {
+		country = code
+	}
+	var radius interface{}
+	if f.RadiusKm > 0 {
+		radius = f.RadiusKm
+	}
+	bbox := []interface{}{nil, nil, nil, nil}
+	if len(f.BBox) == 4 {
+		bbox = []interface{}{f.BBox[1], f.BBox[0], f.BBox[3], f.BBox[2]}
+	}
+	return append([]interface{}{
+		scope, f.Query, f.Type, f.Location, pq.Array(tags), f.CompanyID, f.Status, f.VerifiedOnly,
+		f.MinWeeks, f.MaxWeeks, f.City, f.Region, country, f.MinSalary, f.MaxSalary,
+		f.SalaryCurrency, f.SalaryPeriod, f.StartFrom, f.StartTo, f.NearLat, f.NearLng, radius,
+	}, append(bbox, viewerID)...)
+}
+
+// validate rejects malformed range filters, which would otherwise fail in SQL.
+func (f InternshipFilter) validate() error {
+	if f.StartFrom != "" {
+		if err := validateDate("start_from", &f.StartFrom); err != nil {
+			return err
+		}
+	}
+	if f.StartTo != "" {
+		if err := validateDate("start_to", &f.StartTo); err != nil {
+			return err
+		}
+	}
+	if f.SalaryPeriod != "" && !contains(salaryPeriods, f.SalaryPeriod) {
+		return fmt.Errorf("salary_period must be one of: %s", strings.Join(salaryPeriods, ", "))
+	}
+	if _, ok := internshipSorts[f.Sort]; f.Sort != "" && !ok {
+		return fmt.Errorf("sort must be one of: newest, deadline, salary, duration, start_date, distance")
+	}
+	if (f.NearLat == nil) != (f.NearLng == nil) {
+		return fmt.Errorf("near_lat and near_lng must be given together")
+	}
+	if f.NearLat != nil && (math.Abs(*f.NearLat) > 90 || math.Abs(*f.NearLng) > 180) {
+		return fmt.Errorf("near_lat or near_lng out of range")
+	}
+	hasCenter := f.NearLat != nil || f.Near != ""
+	if f.RadiusKm < 0 || (f.RadiusKm > 0 && !hasCenter) {
+		return fmt.Errorf("radius_km needs a positive value and near, or near_lat and near_lng")
+	}
+	if f.Sort == "distance" && !hasCenter {
+		return fmt.Errorf("sort=distance needs near, or near_lat and near_lng")
+	}
+	if f.BBox != nil {
+		if len(f.BBox) != 4 || math.Abs(f.BBox[0]) > 180 || math.Abs(f.BBox[2]) > 180 ||
+			math.Abs(f.BBox[1]) > 90 || math.Abs(f.BBox[3]) > 90 || f.BBox[1] > f.BBox[3] {
+			return fmt.Errorf("bbox must be min_lng,min_lat,max_lng,max_lat")
+		}
+	}
+	return nil
+}
+
+// locate resolves Near to coordinates with the geocoder.
+func (f *InternshipFilter) locate(g Geocoder) error {
+	if f.Near == "" || f.NearLat != nil {
+		return nil
+	}
+	city, region, country := parseLocation(f.Near)
+	coordinates, err := g.Geocode(Place{derefOr(city), derefOr(region), derefOr(country)})
+	if err != nil {
+		return err
+	}
+	if coordinates == nil {
+		return fmt.Errorf("unknown location: %s", f.Near)
+	}
+	f.NearLat, f.NearLng = &coordinates.Latitude, &coordinates.Longitude
+	return nil
+}
+
+// searchInternships returns the internships matching the filter in its sort order,
+// as seen by viewerID. Extra conditions are ANDed to the filter with their
+// parameters numbered from $28, after those of internshipFilterClause.
+func searchInternships(q sqlQueryer, filter InternshipFilter, scope, viewerID int, extra string, extraArgs ...interface{}) ([]Internship, error) {
+	order, ok := internshipSorts[filter.Sort]
+	if !ok {
+		order = internshipSorts["newest"]
+	}
+	query := internshipSelect + " WHERE " + internshipFilterClause + extra + `
+		GROUP BY i.id
+		ORDER BY ` + order
+	rows, err := q.Query(query, append(filter.args(scope, viewerID), extraArgs...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	internships := []Internship{}
+	for rows.Next() {
+		internship, err := scanInternship(rows)
+		if err != nil {
+			continue
+		}
+		if filter.NearLat != nil && internship.Latitude != nil {
+			distance := math.Round(distanceKm(
+				Coordinates{*filter.NearLat, *filter.NearLng},
+				Coordinates{*internship.Latitude, *internship.Longitude},
+			)*10) / 10
+			internship.DistanceKm = &distance
+		}
+		internships = append(internships, internship)
+	}
+	return internships, nil
+}
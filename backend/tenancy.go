@@ -0,0 +1,389 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Every user and internship belongs to an organization (a university or an
+// employer). Users only see data of their own organization; org admins administer
+// it, and global admins see all organizations.
+//
+// Queries take the caller's tenant scope as a parameter and filter with
+// ($n = 0 OR organization_id = $n). Cross-entity references coming from a request
+// (a mentor ID, an internship ID, ...) are checked with the *InScope lookups below.
+
+var organizationKinds = []string{"university", "employer"}
+
+const defaultOrganizationSlug = "default"
+
+type Organization struct {
+	ID        int       `json:"id" db:"id"`
+	Name      string    `json:"name" db:"name"`
+	Slug      string    `json:"slug" db:"slug"`
+	Kind      string    `json:"kind" db:"kind"`
+	Active    bool      `json:"active" db:"active"`
+	Users     int       `json:"users"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+type OrganizationRequest struct {
+	Name   string `json:"name" binding:"required"`
+	Slug   string `json:"slug" binding:"required"`
+	Kind   string `json:"kind" binding:"required"`
+	Active *bool  `json:"active"`
+}
+
+// currentOrganizationID returns the authenticated user's organization set by
+// authMiddleware.
+func currentOrganizationID(c *gin.Context) int {
+	return c.GetInt("organization_id")
+}
+
+// isAdmin reports whether the caller is a global admin or an admin of their
+// organization. Combine it with tenantScope to keep org admins inside their tenant.
+func isAdmin(c *gin.Context) bool {
+	role := currentUserRole(c)
+	return role == "admin" || role == "org_admin"
+}
+
+// tenantScope returns the organization the caller's queries are restricted to.
+// Global admins are unrestricted (0) unless they pass organization_id; everyone else
+// is bound to their own organization, and a token without one matches nothing.
+func tenantScope(c *gin.Context) int {
+	if currentUserRole(c) == "admin" {
+		id, _ := strconv.Atoi(c.Query("organization_id"))
+		return id
+	}
+	if id := currentOrganizationID(c); id > 0 {
+		return id
+	}
+	return -1
+}
+
+// targetOrganization returns the organization new users created by the caller join:
+// the tenant scope, or the default organization for global admins without
+// organization_id. It writes the error response when there is none.
+func targetOrganization(c *gin.Context) (int, bool) {
+	scope := tenantScope(c)
+	if scope < 0 {
+		c.JSON(http.StatusForbidden, gin.H{"error": "No organization to add users to"})
+		return 0, false
+	}
+	if scope > 0 {
+		return scope, true
+	}
+	id, err := registrationOrganization("")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Default organization not found"})
+		return 0, false
+	}
+	return id, true
+}
+
+func userInScope(q sqlQueryer, scope, userID int) (bool, error) {
+	var found bool
+	err := q.QueryRow(
+		"SELECT EXISTS (SELECT 1 FROM users WHERE id = $1 AND ($2 = 0 OR organization_id = $2))",
+		userID, scope,
+	).Scan(&found)
+	return found, err
+}
+
+func usersInScope(q sqlQueryer, scope int, userIDs []int) (bool, error) {
+	for _, id := range userIDs {
+		found, err := userInScope(q, scope, id)
+		if err != nil || !found {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func internshipInScope(q sqlQueryer, scope, internshipID int) (bool, error) {
+	var found bool
+	err := q.QueryRow(
+		"SELECT EXISTS (SELECT 1 FROM internships WHERE id = $1 AND ($2 = 0 OR organization_id = $2))",
+		internshipID, scope,
+	).Scan(&found)
+	return found, err
+}
+
+func applicationInScope(q sqlQueryer, scope, applicationID int) (bool, error) {
+	var found bool
+	err := q.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM applications a JOIN internships i ON i.id = a.internship_id
+			WHERE a.id = $1 AND ($2 = 0 OR i.organization_id = $2)
+		)
+	`, applicationID, scope).Scan(&found)
+	return found, err
+}
+
+// requireInScope writes a 404 when the lookup fails, so other tenants' records are
+// indistinguishable from missing ones.
+func requireInScope(c *gin.Context, found bool, err error, notFound string) bool {
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": notFound})
+		return false
+	}
+	return true
+}
+
+// defaultOrganizationID returns the organization existing data is assigned to.
+func defaultOrganizationID(q sqlQueryer) (int, error) {
+	var id int
+	err := q.QueryRow("SELECT id FROM organizations WHERE slug = $1", defaultOrganizationSlug).Scan(&id)
+	return id, err
+}
+
+// migrateOrganizations assigns users, internships and webhook subscriptions created
+// before organizations existed, or without one, to the default organization.
+func migrateOrganizations() error {
+	_, err := db.Exec(`
+		INSERT INTO organizations (name, slug, kind) VALUES ('Default', $1, 'university')
+		ON CONFLICT (slug) DO NOTHING
+	`, defaultOrganizationSlug)
+	if err != nil {
+		return err
+	}
+	id, err := defaultOrganizationID(db)
+	if err != nil {
+		return err
+	}
+	if _, err := db.Exec("UPDATE users SET organization_id = $1 WHERE organization_id IS NULL", id); err != nil {
+		return err
+	}
+	// Internships belong to their mentor's organization
+	_, err = db.Exec(`
+		UPDATE internships i SET organization_id = COALESCE(u.organization_id, $1)
+		FROM users u WHERE u.id = i.mentor_id AND i.organization_id IS NULL
+	`, id)
+	if err != nil {
+		return err
+	}
+	if _, err := db.Exec("UPDATE internships SET organization_id = $1 WHERE organization_id IS NULL", id); err != nil {
+		return err
+	}
+	// Webhooks deliver their creator's organization's events
+	_, err = db.Exec(`
+		UPDATE webhook_subscriptions w SET organization_id = COALESCE(
+			(SELECT u.organization_id FROM users u WHERE u.id = w.created_by), $1
+		) WHERE w.organization_id IS NULL
+	`, id)
+	return err
+}
+
+// registrationOrganization resolves the organization a new user joins, by slug,
+// falling back to the default organization.
+func registrationOrganization(slug string) (int, error) {
+	if slug == "" {
+		slug = defaultOrganizationSlug
+	}
+	var id int
+	err := db.QueryRow("SELECT id FROM organizations WHERE slug = $1 AND active", slug).Scan(&id)
+	return id, err
+}
+
+func validateOrganizationRequest(req *OrganizationRequest) error {
+	req.Slug = strings.ToLower(strings.TrimSpace(req.Slug))
+	if !contains(organizationKinds, req.Kind) {
+		return fmt.Errorf("kind must be one of: %s", strings.Join(organizationKinds, ", "))
+	}
+	for _, r := range req.Slug {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-') {
+			return fmt.Errorf("slug may only contain lowercase letters, digits and hyphens")
+		}
+	}
+	if req.Slug == "" {
+		return fmt.Errorf("slug is required")
+	}
+	return nil
+}
+
+const organizationSelect = `
+	SELECT o.id, o.name, o.slug, o.kind, o.active,
+	       (SELECT COUNT(*) FROM users u WHERE u.organization_id = o.id), o.created_at
+	FROM organizations o
+`
+
+func scanOrganization(row interface{ Scan(...interface{}) error }) (Organization, error) {
+	var o Organization
+	err := row.Scan(&o.ID, &o.Name, &o.Slug, &o.Kind, &o.Active, &o.Users, &o.CreatedAt)
+	return o, err
+}
+
+func getOrganizations(c *gin.Context) {
+	rows, err := db.Query(organizationSelect + " ORDER BY o.name")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	organizations := []Organization{}
+	for rows.Next() {
+		o, err := scanOrganization(rows)
+		if err != nil {
+			continue
+		}
+		organizations = append(organizations, o)
+	}
+
+	c.JSON(http.StatusOK, organizations)
+}
+
+// getCurrentOrganization returns the caller's own organization.
+func getCurrentOrganization(c *gin.Context) {
+	o, err := scanOrganization(db.QueryRow(organizationSelect+" WHERE o.id = $1", currentOrganizationID(c)))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Organization not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, o)
+}
+
+func createOrganization(c *gin.Context) {
+	var req OrganizationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateOrganizationRequest(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var id int
+	err := db.QueryRow(
+		"INSERT INTO organizations (name, slug, kind, active) VALUES ($1, $2, $3, $4) RETURNING id",
+		req.Name, req.Slug, req.Kind, req.Active == nil || *req.Active,
+	).Scan(&id)
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Slug already in use"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"id": id, "message": "Organization created successfully"})
+}
+
+func updateOrganization(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+	var req OrganizationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateOrganizationRequest(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := db.Exec(
+		"UPDATE organizations SET name = $1, slug = $2, kind = $3, active = COALESCE($4, active) WHERE id = $5",
+		req.Name, req.Slug, req.Kind, req.Active, id,
+	)
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Slug already in use"})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Organization not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Organization updated successfully"})
+}
+
+type OrganizationMemberRequest struct {
+	Role string `json:"role"`
+}
+
+// assignOrganizationMember moves a user into the organization and optionally changes
+// their role, which is how org admins are appointed. Role changes are recorded like
+// those made through PUT /users/:id/role, and the user signs in again to pick up the
+// new organization or role.
+func assignOrganizationMember(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+	userID, ok := paramID(c, "user_id")
+	if !ok {
+		return
+	}
+	var req OrganizationMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Role != "" && !contains([]string{"student", "mentor", "org_admin"}, req.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "role must be one of: student, mentor, org_admin"})
+		return
+	}
+
+	var exists bool
+	if err := db.QueryRow("SELECT EXISTS (SELECT 1 FROM organizations WHERE id = $1)", id).Scan(&exists); err != nil || !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Organization not found"})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	var role string
+	err = tx.QueryRow(
+		"SELECT role FROM users WHERE id = $1 AND role <> 'admin' AND deleted_at IS NULL FOR UPDATE", userID,
+	).Scan(&role)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	_, err = tx.Exec(`
+		UPDATE users SET organization_id = $1,
+		       token_version = token_version + CASE WHEN organization_id IS DISTINCT FROM $1 THEN 1 ELSE 0 END
+		WHERE id = $2
+	`, id, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Role != "" && req.Role != role {
+		if err := recordRoleChange(tx, userID, role, req.Role, currentUserID(c), nil); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Organization member updated"})
+}
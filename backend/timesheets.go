@@ -0,0 +1,317 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Timesheet struct {
+	ID              int        `json:"id" db:"id"`
+	ApplicationID   int        `json:"application_id" db:"application_id"`
+	InternshipID    int        `json:"internship_id" db:"internship_id"`
+	InternshipTitle string     `json:"internship_title"`
+	StudentID       int        `json:"student_id" db:"student_id"`
+	StudentName     string     `json:"student_name"`
+	WeekStart       string     `json:"week_start" db:"week_start"`
+	Hours           float64    `json:"hours" db:"hours"`
+	Accomplishments string     `json:"accomplishments" db:"accomplishments"`
+	Blockers        *string    `json:"blockers" db:"blockers"`
+	NextWeekPlan    *string    `json:"next_week_plan" db:"next_week_plan"`
+	Status          string     `json:"status" db:"status"`
+	ReviewerID      *int       `json:"reviewer_id" db:"reviewer_id"`
+	ReviewComment   *string    `json:"review_comment" db:"review_comment"`
+	SubmittedAt     time.Time  `json:"submitted_at" db:"submitted_at"`
+	ReviewedAt      *time.Time `json:"reviewed_at" db:"reviewed_at"`
+}
+
+type TimesheetRequest struct {
+	ApplicationID   int     `json:"application_id" binding:"required"`
+	WeekStart       string  `json:"week_start" binding:"required"`
+	Hours           float64 `json:"hours" binding:"min=0,max=168"`
+	Accomplishments string  `json:"accomplishments" binding:"required"`
+	Blockers        *string `json:"blockers"`
+	NextWeekPlan    *string `json:"next_week_plan"`
+}
+
+type TimesheetReviewRequest struct {
+	Comment *string `json:"comment"`
+}
+
+type TimesheetSummary struct {
+	InternshipID    int     `json:"internship_id"`
+	InternshipTitle string  `json:"internship_title"`
+	StudentID       int     `json:"student_id"`
+	StudentName     string  `json:"student_name"`
+	Weeks           int     `json:"weeks"`
+	SubmittedHours  float64 `json:"submitted_hours"`
+	ApprovedHours   float64 `json:"approved_hours"`
+	PendingHours    float64 `json:"pending_hours"`
+	RejectedHours   float64 `json:"rejected_hours"`
+}
+
+const timesheetSelect = `
+	SELECT t.id, t.application_id, a.internship_id, i.title, a.student_id, a.student_name,
+	       to_char(t.week_start, 'YYYY-MM-DD'), t.hours, t.accomplishments, t.blockers, t.next_week_plan,
+	       t.status, t.reviewer_id, t.review_comment, t.submitted_at, t.reviewed_at
+	FROM timesheets t
+	JOIN applications a ON a.id = t.application_id
+	JOIN internships i ON i.id = a.internship_id
+`
+
+func scanTimesheet(row interface{ Scan(...interface{}) error }) (Timesheet, error) {
+	var t Timesheet
+	err := row.Scan(&t.ID, &t.ApplicationID, &t.InternshipID, &t.InternshipTitle, &t.StudentID, &t.StudentName,
+		&t.WeekStart, &t.Hours, &t.Accomplishments, &t.Blockers, &t.NextWeekPlan,
+		&t.Status, &t.ReviewerID, &t.ReviewComment, &t.SubmittedAt, &t.ReviewedAt)
+	return t, err
+}
+
+// parseWeekStart validates a YYYY-MM-DD date and normalizes it to the Monday of its week.
+func parseWeekStart(value string) (string, bool) {
+	day, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return "", false
+	}
+	offset := (int(day.Weekday()) + 6) % 7
+	return day.AddDate(0, 0, -offset).Format("2006-01-02"), true
+}
+
+// getTimesheets lists timesheets visible to the caller: their own as an intern, those
+// of their internships as a mentor, or all of them as an admin. Filters:
+// application_id, internship_id, student_id, status.
+func getTimesheets(c *gin.Context) {
+	rows, err := db.Query(timesheetSelect+`
+		WHERE ($1 IN ('admin', 'org_admin') OR a.student_id = $2 OR i.mentor_id = $2)
+		  AND ($7 = 0 OR i.organization_id = $7)
+		  AND ($3 = '' OR t.application_id::text = $3)
+		  AND ($4 = '' OR a.internship_id::text = $4)
+		  AND ($5 = '' OR a.student_id::text = $5)
+		  AND ($6 = '' OR t.status = $6)
+		ORDER BY t.week_start DESC, t.id DESC
+	`, currentUserRole(c), currentUserID(c), c.Query("application_id"), c.Query("internship_id"),
+		c.Query("student_id"), c.Query("status"), tenantScope(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	timesheets := []Timesheet{}
+	for rows.Next() {
+		t, err := scanTimesheet(rows)
+		if err != nil {
+			continue
+		}
+		timesheets = append(timesheets, t)
+	}
+
+	c.JSON(http.StatusOK, timesheets)
+}
+
+// submitTimesheet records an intern's week on an accepted application. Resubmitting
+// a week that is pending or was rejected replaces it and puts it back into review.
+func submitTimesheet(c *gin.Context) {
+	var req TimesheetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	weekStart, ok := parseWeekStart(req.WeekStart)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "week_start must be YYYY-MM-DD"})
+		return
+	}
+
+	userID := currentUserID(c)
+	var status, title string
+	var mentorID int
+	err := db.QueryRow(`
+		SELECT a.status, i.mentor_id, i.title FROM applications a
+		JOIN internships i ON i.id = a.internship_id
+		WHERE a.id = $1 AND a.student_id = $2
+	`, req.ApplicationID, userID).Scan(&status, &mentorID, &title)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Application not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if status != "accepted" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Timesheets can only be submitted for accepted applications"})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	var id int
+	err = tx.QueryRow(`
+		INSERT INTO timesheets (application_id, week_start, hours, accomplishments, blockers, next_week_plan)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (application_id, week_start) DO UPDATE
+		SET hours = EXCLUDED.hours, accomplishments = EXCLUDED.accomplishments, blockers = EXCLUDED.blockers,
+		    next_week_plan = EXCLUDED.next_week_plan, status = 'submitted', reviewer_id = NULL,
+		    review_comment = NULL, reviewed_at = NULL, submitted_at = CURRENT_TIMESTAMP
+		WHERE timesheets.status <> 'approved'
+		RETURNING id
+	`, req.ApplicationID, weekStart, req.Hours, req.Accomplishments, req.Blockers, req.NextWeekPlan).Scan(&id)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusConflict, gin.H{"error": "This week has already been approved"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	data := map[string]interface{}{"timesheet_id": id, "internship_title": title, "week_start": weekStart, "hours": req.Hours}
+	if err := dispatchEvent(tx, DomainEvent{Type: EventTimesheetSubmitted, ActorID: userID, Recipients: []int{mentorID}, Data: data}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"id": id, "week_start": weekStart, "message": "Timesheet submitted successfully"})
+}
+
+// reviewTimesheet approves or rejects a submitted timesheet. Only the internship's
+// mentor or an admin may review.
+func reviewTimesheet(approve bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := paramID(c, "id")
+		if !ok {
+			return
+		}
+		var req TimesheetReviewRequest
+		c.ShouldBindJSON(&req)
+		if !approve && (req.Comment == nil || *req.Comment == "") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "A comment is required when rejecting a timesheet"})
+			return
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		defer tx.Rollback()
+
+		var mentorID int
+		t, err := scanTimesheet(tx.QueryRow(timesheetSelect+" WHERE t.id = $1 FOR UPDATE OF t", id))
+		if err == nil {
+			err = tx.QueryRow(
+				"SELECT mentor_id FROM internships WHERE id = $1 AND ($2 = 0 OR organization_id = $2)",
+				t.InternshipID, tenantScope(c),
+			).Scan(&mentorID)
+		}
+		if err == sql.ErrNoRows || (err == nil && mentorID != currentUserID(c) && !isAdmin(c)) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Timesheet not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if t.Status != "submitted" {
+			c.JSON(http.StatusConflict, gin.H{"error": "Timesheet has already been reviewed"})
+			return
+		}
+
+		status, eventType := "rejected", EventTimesheetRejected
+		if approve {
+			status, eventType = "approved", EventTimesheetApproved
+		}
+
+		_, err = tx.Exec(`
+			UPDATE timesheets SET status = $1, reviewer_id = $2, review_comment = $3, reviewed_at = CURRENT_TIMESTAMP
+			WHERE id = $4
+		`, status, currentUserID(c), req.Comment, id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		data := map[string]interface{}{
+			"timesheet_id":     id,
+			"internship_title": t.InternshipTitle,
+			"week_start":       t.WeekStart,
+			"comment":          req.Comment,
+		}
+		if err := dispatchEvent(tx, DomainEvent{Type: eventType, ActorID: currentUserID(c), Recipients: []int{t.StudentID}, Data: data}); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := tx.Commit(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Timesheet " + status})
+	}
+}
+
+// getTimesheetSummary aggregates hours per intern per internship, optionally limited
+// to weeks between "from" and "to" (YYYY-MM-DD) and to one internship.
+func getTimesheetSummary(c *gin.Context) {
+	from, to := c.Query("from"), c.Query("to")
+	for field, date := range map[string]string{"from": from, "to": to} {
+		if date == "" {
+			continue
+		}
+		if err := validateDate(field, &date); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	rows, err := db.Query(`
+		SELECT a.internship_id, i.title, a.student_id, a.student_name,
+		       COUNT(t.id),
+		       COALESCE(SUM(t.hours), 0),
+		       COALESCE(SUM(t.hours) FILTER (WHERE t.status = 'approved'), 0),
+		       COALESCE(SUM(t.hours) FILTER (WHERE t.status = 'submitted'), 0),
+		       COALESCE(SUM(t.hours) FILTER (WHERE t.status = 'rejected'), 0)
+		FROM timesheets t
+		JOIN applications a ON a.id = t.application_id
+		JOIN internships i ON i.id = a.internship_id
+		WHERE ($1 IN ('admin', 'org_admin') OR a.student_id = $2 OR i.mentor_id = $2)
+		  AND ($6 = 0 OR i.organization_id = $6)
+		  AND ($3 = '' OR a.internship_id::text = $3)
+		  AND t.week_start >= COALESCE(NULLIF($4, '')::date, '-infinity'::date)
+		  AND t.week_start <= COALESCE(NULLIF($5, '')::date, 'infinity'::date)
+		GROUP BY a.internship_id, i.title, a.student_id, a.student_name
+		ORDER BY i.title, a.student_name
+	`, currentUserRole(c), currentUserID(c), c.Query("internship_id"), from, to, tenantScope(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	summaries := []TimesheetSummary{}
+	for rows.Next() {
+		var s TimesheetSummary
+		err := rows.Scan(&s.InternshipID, &s.InternshipTitle, &s.StudentID, &s.StudentName, &s.Weeks,
+			&s.SubmittedHours, &s.ApprovedHours, &s.PendingHours, &s.RejectedHours)
+		if err != nil {
+			continue
+		}
+		summaries = append(summaries, s)
+	}
+
+	c.JSON(http.StatusOK, summaries)
+}
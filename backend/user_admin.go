@@ -0,0 +1,367 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Admins and org admins manage the accounts of their organization: they suspend
+// and reactivate accounts, change roles, force password resets and delete users.
+// Suspending, changing the role of or resetting the password of an account bumps
+// its token_version, which signs it out everywhere. Only global admins manage
+// other admins, and nobody manages their own account this way.
+
+type UserSuspensionRequest struct {
+	Reason string `json:"reason" binding:"required"`
+}
+
+type UserRoleRequest struct {
+	Role   string  `json:"role" binding:"required"`
+	Reason *string `json:"reason"`
+}
+
+type UserRoleChange struct {
+	ID            int       `json:"id" db:"id"`
+	UserID        int       `json:"user_id" db:"user_id"`
+	FromRole      string    `json:"from_role" db:"from_role"`
+	ToRole        string    `json:"to_role" db:"to_role"`
+	ChangedBy     *int      `json:"changed_by" db:"changed_by"`
+	ChangedByName *string   `json:"changed_by_name"`
+	Reason        *string   `json:"reason" db:"reason"`
+	CreatedAt     time.Time `json:"created_at" db:"created_at"`
+}
+
+// deletedUserName replaces the name of anonymized users and their applications.
+const deletedUserName = "Deleted user"
+
+// deletedMessageBody replaces the messages of anonymized users.
+const deletedMessageBody = "This message was deleted."
+
+// accountStatus rejects tokens of suspended or deleted accounts, and tokens issued
+// before the account's sessions were revoked.
+func accountStatus(userID, tokenVersion int) (int, string) {
+	var suspended bool
+	var version int
+	err := db.QueryRow(
+		"SELECT suspended_at IS NOT NULL, token_version FROM users WHERE id = $1 AND deleted_at IS NULL", userID,
+	).Scan(&suspended, &version)
+	if err == sql.ErrNoRows {
+		return http.StatusUnauthorized, "Account not found"
+	}
+	if err != nil {
+		return http.StatusInternalServerError, err.Error()
+	}
+	if suspended {
+		return http.StatusForbidden, "Account suspended"
+	}
+	if version != tokenVersion {
+		return http.StatusUnauthorized, "Session expired, please sign in again"
+	}
+	return 0, ""
+}
+
+type managedUser struct {
+	ID        int
+	Email     string
+	Name      string
+	Role      string
+	Suspended bool
+}
+
+// loadManagedUser reads the user in the :id parameter that the caller may manage,
+// writing the error response when there is none.
+func loadManagedUser(c *gin.Context) (managedUser, bool) {
+	var u managedUser
+	id, ok := paramID(c, "id")
+	if !ok {
+		return u, false
+	}
+	if id == currentUserID(c) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot manage your own account"})
+		return u, false
+	}
+
+	err := db.QueryRow(`
+		SELECT id, email, name, role, suspended_at IS NOT NULL FROM users
+		WHERE id = $1 AND deleted_at IS NULL AND ($2 = 0 OR organization_id = $2)
+	`, id, tenantScope(c)).Scan(&u.ID, &u.Email, &u.Name, &u.Role, &u.Suspended)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return u, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return u, false
+	}
+	if u.Role == "admin" && currentUserRole(c) != "admin" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only admins can manage admins"})
+		return u, false
+	}
+	return u, true
+}
+
+// suspendUser blocks the user from signing in and revokes their sessions.
+func suspendUser(c *gin.Context) {
+	var req UserSuspensionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	u, ok := loadManagedUser(c)
+	if !ok {
+		return
+	}
+	if u.Suspended {
+		c.JSON(http.StatusConflict, gin.H{"error": "User is already suspended"})
+		return
+	}
+
+	_, err := db.Exec(`
+		UPDATE users SET suspended_at = CURRENT_TIMESTAMP, suspended_by = $1, suspension_reason = $2,
+		       token_version = token_version + 1
+		WHERE id = $3
+	`, currentUserID(c), strings.TrimSpace(req.Reason), u.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User suspended"})
+}
+
+func reactivateUser(c *gin.Context) {
+	u, ok := loadManagedUser(c)
+	if !ok {
+		return
+	}
+	if !u.Suspended {
+		c.JSON(http.StatusConflict, gin.H{"error": "User is not suspended"})
+		return
+	}
+
+	_, err := db.Exec(
+		"UPDATE users SET suspended_at = NULL, suspended_by = NULL, suspension_reason = NULL WHERE id = $1", u.ID,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User reactivated"})
+}
+
+// changeUserRole assigns a new role and records the change. The user signs in
+// again to pick up the role.
+func changeUserRole(c *gin.Context) {
+	var req UserRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if roles := assignableRoles(c); !contains(roles, req.Role) {
+		c.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("role must be one of: %s", strings.Join(roles, ", "))})
+		return
+	}
+	u, ok := loadManagedUser(c)
+	if !ok {
+		return
+	}
+	if u.Role == req.Role {
+		c.JSON(http.StatusConflict, gin.H{"error": "User already has this role"})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	if err := recordRoleChange(tx, u.ID, u.Role, req.Role, currentUserID(c), req.Reason); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Role changed", "role": req.Role})
+}
+
+// recordRoleChange assigns the role, records the change and revokes the user's
+// sessions. Every role change goes through it.
+func recordRoleChange(tx *sql.Tx, userID int, fromRole, toRole string, changedBy int, reason *string) error {
+	if _, err := tx.Exec("UPDATE users SET role = $1, token_version = token_version + 1 WHERE id = $2", toRole, userID); err != nil {
+		return err
+	}
+	_, err := tx.Exec(`
+		INSERT INTO user_role_changes (user_id, from_role, to_role, changed_by, reason) VALUES ($1, $2, $3, $4, $5)
+	`, userID, fromRole, toRole, changedBy, reason)
+	return err
+}
+
+func getUserRoleChanges(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+	found, err := userInScope(db, tenantScope(c), id)
+	if !requireInScope(c, found, err, "User not found") {
+		return
+	}
+
+	rows, err := db.Query(`
+		SELECT r.id, r.user_id, r.from_role, r.to_role, r.changed_by, u.name, r.reason, r.created_at
+		FROM user_role_changes r
+		LEFT JOIN users u ON u.id = r.changed_by
+		WHERE r.user_id = $1
+		ORDER BY r.created_at DESC, r.id DESC
+	`, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	changes := []UserRoleChange{}
+	for rows.Next() {
+		var r UserRoleChange
+		if err := rows.Scan(&r.ID, &r.UserID, &r.FromRole, &r.ToRole, &r.ChangedBy, &r.ChangedByName, &r.Reason, &r.CreatedAt); err != nil {
+			continue
+		}
+		changes = append(changes, r)
+	}
+
+	c.JSON(http.StatusOK, changes)
+}
+
+// forcePasswordReset clears the user's password, revokes their sessions and emails
+// them a link to choose a new one.
+func forcePasswordReset(c *gin.Context) {
+	u, ok := loadManagedUser(c)
+	if !ok {
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("UPDATE users SET password_hash = '', token_version = token_version + 1 WHERE id = $1", u.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	link, err := issuePasswordToken(tx, u.ID, passwordTokenReset, resetTokenTTL)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	err = enqueueEmail(tx, &u.ID, u.Email, u.Name, "account.password_reset", "Reset your LMS Internship Portal password",
+		map[string]interface{}{
+			"url":        link,
+			"expires_on": time.Now().UTC().Add(resetTokenTTL).Format("January 2, 2006 15:04 MST"),
+		})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password reset email sent"})
+}
+
+// deleteUser removes a user. With applications=cascade the account is deleted
+// together with everything it owns, including applications and, for mentors, their
+// internships. With applications=anonymize, the default, the account is kept as an
+// anonymous tombstone so applications and internships remain in statistics without
+// personal data: what the user wrote is cleared, their notifications and unsent
+// emails are dropped, and their open internships, mentorships and meetings are
+// closed.
+func deleteUser(c *gin.Context) {
+	mode := c.DefaultQuery("applications", "anonymize")
+	if mode != "cascade" && mode != "anonymize" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "applications must be one of: cascade, anonymize"})
+		return
+	}
+	u, ok := loadManagedUser(c)
+	if !ok {
+		return
+	}
+
+	if mode == "cascade" {
+		if _, err := db.Exec("DELETE FROM users WHERE id = $1", u.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "User deleted", "applications": mode})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	statements := []struct {
+		query string
+		args  []interface{}
+	}{
+		{"UPDATE applications SET student_name = $2, cover_letter = '', resume = NULL WHERE student_id = $1", []interface{}{u.ID, deletedUserName}},
+		{"UPDATE internships SET mentor_name = $2 WHERE mentor_id = $1", []interface{}{u.ID, deletedUserName}},
+		{"UPDATE internships SET status = 'closed', publish_at = NULL WHERE mentor_id = $1 AND status IN ('active', 'draft')", []interface{}{u.ID}},
+		{`UPDATE mentorships SET status = CASE WHEN status = 'active' THEN 'ended' ELSE 'cancelled' END,
+		        ended_at = CURRENT_TIMESTAMP, ended_by = $2, end_reason = 'Account deleted'
+		 WHERE (mentor_id = $1 OR student_id = $1) AND status IN ('requested', 'active')`, []interface{}{u.ID, currentUserID(c)}},
+		{"UPDATE mentorships SET message = NULL WHERE student_id = $1", []interface{}{u.ID}},
+		{`UPDATE meetings SET status = 'cancelled', cancelled_by = $2, cancel_reason = 'Account deleted', updated_at = CURRENT_TIMESTAMP
+		 WHERE (mentor_id = $1 OR student_id = $1) AND status = 'scheduled' AND starts_at > CURRENT_TIMESTAMP`, []interface{}{u.ID, currentUserID(c)}},
+		{"UPDATE messages SET body = $2 WHERE sender_id = $1", []interface{}{u.ID, deletedMessageBody}},
+		{"DELETE FROM conversation_participants WHERE user_id = $1", []interface{}{u.ID}},
+		{"DELETE FROM notifications WHERE user_id = $1", []interface{}{u.ID}},
+		{"DELETE FROM email_outbox WHERE (recipient_user_id = $1 OR recipient_email = $2) AND status = 'pending'", []interface{}{u.ID, u.Email}},
+		{`UPDATE email_outbox SET recipient_email = 'deleted-' || $1 || '@deleted.invalid', recipient_name = NULL, data = NULL
+		 WHERE recipient_user_id = $1 OR recipient_email = $2`, []interface{}{u.ID, u.Email}},
+		// Free-text answers are comments by or about the user; ratings stay for statistics
+		{`UPDATE evaluations e SET answers = e.answers - ARRAY(
+		        SELECT q->>'id' FROM jsonb_array_elements(COALESCE(e.questions, t.questions)) q WHERE q->>'type' = 'text')
+		 FROM evaluation_templates t
+		 WHERE t.id = e.template_id AND (e.evaluator_id = $1 OR e.evaluatee_id = $1) AND e.answers IS NOT NULL`, []interface{}{u.ID}},
+		{`UPDATE timesheets SET accomplishments = '', blockers = NULL, next_week_plan = NULL, review_comment = NULL
+		 WHERE application_id IN (SELECT id FROM applications WHERE student_id = $1)`, []interface{}{u.ID}},
+		{"UPDATE timesheets SET review_comment = NULL WHERE reviewer_id = $1", []interface{}{u.ID}},
+		{`UPDATE milestones SET intern_note = NULL, evidence_links = NULL
+		 WHERE goal_id IN (SELECT g.id FROM goals g JOIN applications a ON a.id = g.application_id WHERE a.student_id = $1)`, []interface{}{u.ID}},
+		{"UPDATE password_tokens SET used_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND used_at IS NULL", []interface{}{u.ID}},
+		{`UPDATE users SET email = 'deleted-' || id || '@deleted.invalid', name = $2, password_hash = '',
+		        avatar = NULL, department = NULL, bio = NULL, skills = '{}', experience = NULL, calendar_token = NULL,
+		        company = NULL, company_id = NULL, deleted_at = CURRENT_TIMESTAMP, token_version = token_version + 1
+		 WHERE id = $1`, []interface{}{u.ID, deletedUserName}},
+	}
+	for _, s := range statements {
+		if _, err := tx.Exec(s.query, s.args...); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User deleted", "applications": mode})
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+	"net/mail"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// Bulk import creates many users at once from a CSV file or a JSON array. Imported
+// users get no password; each is emailed an invitation link to set one. Rows with
+// errors are reported and skipped, and a dry run only validates.
+
+const (
+	maxImportRows  = 5000
+	maxImportBytes = 5 << 20
+)
+
+// UserImportRow is one user to import. Role and Company default to the role and
+// company query parameters.
+type UserImportRow struct {
+	Email      string `json:"email"`
+	Name       string `json:"name"`
+	Role       string `json:"role"`
+	Department string `json:"department"`
+	Company    string `json:"company"`
+}
+
+// UserImportError lists the problems of a row, numbered from 1 without the CSV
+// header.
+type UserImportError struct {
+	Row    int      `json:"row"`
+	Email  string   `json:"email"`
+	Errors []string `json:"errors"`
+}
+
+type ImportedUser struct {
+	Row   int    `json:"row"`
+	ID    int    `json:"id"`
+	Email string `json:"email"`
+}
+
+type UserImportResult struct {
+	DryRun  bool              `json:"dry_run"`
+	Total   int               `json:"total"`
+	Valid   int               `json:"valid"`
+	Created int               `json:"created"`
+	Errors  []UserImportError `json:"errors"`
+	Users   []ImportedUser    `json:"users"`
+}
+
+// assignableRoles are the roles the caller may give imported or invited users: org
+// admins cannot create global admins, and mentors only invite other mentors.
+func assignableRoles(c *gin.Context) []string {
+	switch currentUserRole(c) {
+	case "admin":
+		return []string{"student", "mentor", "org_admin", "admin"}
+	case "org_admin":
+		return []string{"student", "mentor", "org_admin"}
+	}
+	return []string{"mentor"}
+}
+
+// readUserImport reads the rows from a JSON array, a multipart file upload named
+// file, or a CSV body.
+func readUserImport(c *gin.Context) ([]UserImportRow, error) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportBytes)
+
+	var rows []UserImportRow
+	switch c.ContentType() {
+	case "application/json":
+		if err := c.ShouldBindJSON(&rows); err != nil {
+			return nil, err
+		}
+	case "multipart/form-data":
+		header, err := c.FormFile("file")
+		if err != nil {
+			return nil, fmt.Errorf("file is required")
+		}
+		f, err := header.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		if rows, err = parseUserImportCSV(f); err != nil {
+			return nil, err
+		}
+	default:
+		var err error
+		if rows, err = parseUserImportCSV(c.Request.Body); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("no users to import")
+	}
+	if len(rows) > maxImportRows {
+		return nil, fmt.Errorf("at most %d users can be imported at once", maxImportRows)
+	}
+	return rows, nil
+}
+
+// parseUserImportCSV reads a CSV file whose header names the columns email, name,
+// role, department and company, in any order. Email and name are required.
+func parseUserImportCSV(r io.Reader) ([]UserImportRow, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("no users to import")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV: %v", err)
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+	for _, required := range []string{"email", "name"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("CSV header must include %s", required)
+		}
+	}
+
+	var rows []UserImportRow
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV: %v", err)
+		}
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		rows = append(rows, UserImportRow{
+			Email:      field("email"),
+			Name:       field("name"),
+			Role:       field("role"),
+			Department: field("department"),
+			Company:    field("company"),
+		})
+		if len(rows) > maxImportRows {
+			break
+		}
+	}
+	return rows, nil
+}
+
+// validateUserImport normalizes the rows and returns the errors of the invalid
+// ones, keyed by index. Emails are compared case-insensitively, against each other
+// and against existing users.
+func validateUserImport(rows []UserImportRow, roles []string, defaultRole, defaultCompany string) (map[int][]string, error) {
+	problems := map[int][]string{}
+	seen := map[string]int{}
+	var emails []string
+	for i := range rows {
+		row := &rows[i]
+		row.Email = strings.ToLower(strings.TrimSpace(row.Email))
+		row.Name = strings.TrimSpace(row.Name)
+		if row.Role = strings.TrimSpace(row.Role); row.Role == "" {
+			row.Role = defaultRole
+		}
+		if row.Company = strings.TrimSpace(row.Company); row.Company == "" {
+			row.Company = defaultCompany
+		}
+
+		if address, err := mail.ParseAddress(row.Email); err != nil || address.Address != row.Email {
+			problems[i] = append(problems[i], "invalid email")
+		} else if first, ok := seen[row.Email]; ok {
+			problems[i] = append(problems[i], fmt.Sprintf("duplicate of row %d", first+1))
+		} else {
+			seen[row.Email] = i
+			emails = append(emails, row.Email)
+		}
+		if row.Name == "" {
+			problems[i] = append(problems[i], "name is required")
+		}
+		if !contains(roles, row.Role) {
+			problems[i] = append(problems[i], fmt.Sprintf("role must be one of: %s", strings.Join(roles, ", ")))
+		}
+	}
+
+	existing, err := db.Query("SELECT lower(email) FROM users WHERE lower(email) = ANY($1)", pq.Array(emails))
+	if err != nil {
+		return nil, err
+	}
+	defer existing.Close()
+	for existing.Next() {
+		var email string
+		if err := existing.Scan(&email); err != nil {
+			return nil, err
+		}
+		i := seen[email]
+		problems[i] = append(problems[i], "email already registered")
+	}
+	return problems, existing.Err()
+}
+
+// checkImportCompanies rejects rows joining an existing company the caller cannot
+// manage, since its members can manage it in turn. Unknown companies are created.
+func checkImportCompanies(c *gin.Context, rows []UserImportRow, problems map[int][]string) error {
+	allowed := map[string]bool{}
+	for i, row := range rows {
+		key := normalizeCompanyName(row.Company)
+		if key == "" {
+			continue
+		}
+		ok, checked := allowed[key]
+		if !checked {
+			var id int
+			err := db.QueryRow("SELECT id FROM companies WHERE normalized_name = $1", key).Scan(&id)
+			switch {
+			case err == sql.ErrNoRows:
+				ok = true
+			case err != nil:
+				return err
+			default:
+				if ok, err = canManageCompany(c, id); err != nil {
+					return err
+				}
+			}
+			allowed[key] = ok
+		}
+		if !ok {
+			problems[i] = append(problems[i], fmt.Sprintf("not allowed to add users to company %s", row.Company))
+		}
+	}
+	return nil
+}
+
+// importUsers creates the valid rows as users of the caller's organization (or the
+// default organization for global admins without organization_id) and invites
+// them. Pass dry_run=true to only validate.
+func importUsers(c *gin.Context) {
+	rows, err := readUserImport(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	organizationID, ok := targetOrganization(c)
+	if !ok {
+		return
+	}
+
+	roles := assignableRoles(c)
+	defaultRole := c.DefaultQuery("role", "student")
+	if !contains(roles, defaultRole) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("role must be one of: %s", strings.Join(roles, ", "))})
+		return
+	}
+	problems, err := validateUserImport(rows, roles, defaultRole, c.Query("company"))
+	if err == nil {
+		err = checkImportCompanies(c, rows, problems)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	result := UserImportResult{
+		DryRun: c.Query("dry_run") == "true",
+		Total:  len(rows),
+		Valid:  len(rows) - len(problems),
+		Errors: []UserImportError{},
+		Users:  []ImportedUser{},
+	}
+	for i, row := range rows {
+		if errs, ok := problems[i]; ok {
+			result.Errors = append(result.Errors, UserImportError{Row: i + 1, Email: row.Email, Errors: errs})
+		}
+	}
+	if result.DryRun || result.Valid == 0 {
+		c.JSON(http.StatusOK, result)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	for i, row := range rows {
+		if _, ok := problems[i]; ok {
+			continue
+		}
+		companyID, company, err := resolveCompany(tx, row.Company)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		var id int
+		err = tx.QueryRow(`
+			INSERT INTO users (email, password_hash, name, role, department, company, company_id, organization_id)
+			VALUES ($1, '', $2, $3, NULLIF($4, ''), NULLIF($5, ''), $6, $7) RETURNING id
+		`, row.Email, row.Name, row.Role, row.Department, company, companyID, organizationID).Scan(&id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("row %d: %v", i+1, err)})
+			return
+		}
+		if err := sendInvitation(tx, id, row.Email, row.Name); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		result.Users = append(result.Users, ImportedUser{Row: i + 1, ID: id, Email: row.Email})
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	result.Created = len(result.Users)
+
+	c.JSON(http.StatusOK, result)
+}
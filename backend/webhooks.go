@@ -0,0 +1,565 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+const (
+	WebhookInternshipCreated        = "internship.created"
+	WebhookInternshipPublished      = "internship.published"
+	WebhookApplicationSubmitted     = "application.submitted"
+	WebhookApplicationStatusChanged = "application.status_changed"
+)
+
+// webhookEvents maps domain events to the event names published to partners.
+var webhookEvents = map[string]string{
+	EventInternshipCreated:        WebhookInternshipCreated,
+	EventInternshipPublished:      WebhookInternshipPublished,
+	EventApplicationCreated:       WebhookApplicationSubmitted,
+	EventApplicationStatusChanged: WebhookApplicationStatusChanged,
+}
+
+var webhookEventTypes = []string{
+	WebhookInternshipCreated, WebhookInternshipPublished, WebhookApplicationSubmitted, WebhookApplicationStatusChanged,
+}
+
+// maxWebhookResponseBody limits how much of a partner's response is kept in the log.
+const maxWebhookResponseBody = 4096
+
+var webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+type WebhookSubscription struct {
+	ID             int       `json:"id" db:"id"`
+	URL            string    `json:"url" db:"url"`
+	Secret         string    `json:"secret,omitempty" db:"secret"`
+	EventTypes     []string  `json:"event_types" db:"event_types"`
+	Description    *string   `json:"description" db:"description"`
+	Active         bool      `json:"active" db:"active"`
+	OrganizationID *int      `json:"organization_id" db:"organization_id"`
+	CompanyID      *int      `json:"company_id" db:"company_id"`
+	CreatedBy      *int      `json:"created_by" db:"created_by"`
+	CreatedAt      time.Time `json:"created_at" db:"created_at"`
+}
+
+type WebhookDelivery struct {
+	ID             int             `json:"id" db:"id"`
+	SubscriptionID int             `json:"subscription_id" db:"subscription_id"`
+	EventType      string          `json:"event_type" db:"event_type"`
+	Payload        json.RawMessage `json:"payload" db:"payload"`
+	Status         string          `json:"status" db:"status"`
+	Attempts       int             `json:"attempts" db:"attempts"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at" db:"next_attempt_at"`
+	ResponseStatus *int            `json:"response_status" db:"response_status"`
+	LastError      *string         `json:"last_error" db:"last_error"`
+	CreatedAt      time.Time       `json:"created_at" db:"created_at"`
+	DeliveredAt    *time.Time      `json:"delivered_at" db:"delivered_at"`
+}
+
+type WebhookDeliveryAttempt struct {
+	ID             int       `json:"id" db:"id"`
+	DeliveryID     int       `json:"delivery_id" db:"delivery_id"`
+	AttemptedAt    time.Time `json:"attempted_at" db:"attempted_at"`
+	ResponseStatus *int      `json:"response_status" db:"response_status"`
+	ResponseBody   *string   `json:"response_body" db:"response_body"`
+	Error          *string   `json:"error" db:"error"`
+	DurationMs     int       `json:"duration_ms" db:"duration_ms"`
+}
+
+type WebhookRequest struct {
+	URL         string   `json:"url" binding:"required"`
+	EventTypes  []string `json:"event_types" binding:"required"`
+	Description *string  `json:"description"`
+	CompanyID   *int     `json:"company_id"`
+	Active      *bool    `json:"active"`
+}
+
+func init() {
+	onDomainEvent(enqueueWebhookDeliveries)
+}
+
+// enqueueWebhookDeliveries creates a pending delivery for every active subscription
+// to the event in the internship's organization, and for its company when the
+// subscription is limited to one.
+func enqueueWebhookDeliveries(tx *sql.Tx, event DomainEvent) error {
+	name, ok := webhookEvents[event.Type]
+	if !ok {
+		return nil
+	}
+	internshipID, ok := eventInternshipID(event)
+	if !ok {
+		return fmt.Errorf("webhook event %s has no internship", name)
+	}
+
+	payload, err := json.Marshal(gin.H{
+		"event":       name,
+		"occurred_at": time.Now().UTC(),
+		"data":        event.Data,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO webhook_deliveries (subscription_id, event_type, payload)
+		SELECT s.id, $1, $2 FROM webhook_subscriptions s JOIN internships i ON i.id = $3
+		WHERE s.active AND $1 = ANY(s.event_types)
+		  AND s.organization_id = i.organization_id
+		  AND (s.company_id IS NULL OR s.company_id = i.company_id)
+	`, name, payload, internshipID)
+	return err
+}
+
+// eventInternshipID returns the internship a webhook event is about.
+func eventInternshipID(event DomainEvent) (int, bool) {
+	if internship, ok := event.Data["internship"].(Internship); ok {
+		return internship.ID, true
+	}
+	id, ok := event.Data["internship_id"].(int)
+	return id, ok
+}
+
+// signWebhook computes the hex HMAC-SHA256 of "timestamp.body" with the subscription secret.
+func signWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func generateSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// hashToken returns the hex SHA-256 of a token, which is stored in its place so
+// a leaked database does not leak working links.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func validateWebhookRequest(req WebhookRequest) error {
+	u, err := url.Parse(req.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("url must be an absolute http(s) URL")
+	}
+	if len(req.EventTypes) == 0 {
+		return fmt.Errorf("at least one event type is required")
+	}
+	for _, eventType := range req.EventTypes {
+		if !contains(webhookEventTypes, eventType) {
+			return fmt.Errorf("unknown event type %q", eventType)
+		}
+	}
+	return nil
+}
+
+// requireWebhookCompany checks that the company a subscription is limited to exists.
+func requireWebhookCompany(c *gin.Context, companyID *int) bool {
+	if companyID == nil {
+		return true
+	}
+	var found bool
+	err := db.QueryRow("SELECT EXISTS (SELECT 1 FROM companies WHERE id = $1)", *companyID).Scan(&found)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	if !found {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Company not found"})
+		return false
+	}
+	return true
+}
+
+func getWebhooks(c *gin.Context) {
+	rows, err := db.Query(`
+		SELECT id, url, event_types, description, active, organization_id, company_id, created_by, created_at
+		FROM webhook_subscriptions WHERE ($1 = 0 OR organization_id = $1) ORDER BY id
+	`, tenantScope(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	webhooks := []WebhookSubscription{}
+	for rows.Next() {
+		var w WebhookSubscription
+		err := rows.Scan(&w.ID, &w.URL, pq.Array(&w.EventTypes), &w.Description, &w.Active, &w.OrganizationID, &w.CompanyID,
+			&w.CreatedBy, &w.CreatedAt)
+		if err != nil {
+			continue
+		}
+		webhooks = append(webhooks, w)
+	}
+
+	c.JSON(http.StatusOK, webhooks)
+}
+
+func createWebhook(c *gin.Context) {
+	var req WebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateWebhookRequest(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !requireWebhookCompany(c, req.CompanyID) {
+		return
+	}
+	// Subscriptions only receive events from the organization they were created for
+	organizationID, ok := targetOrganization(c)
+	if !ok {
+		return
+	}
+
+	secret, err := generateSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate secret"})
+		return
+	}
+
+	active := req.Active == nil || *req.Active
+	var id int
+	err = db.QueryRow(
+		`INSERT INTO webhook_subscriptions (url, secret, event_types, description, active, organization_id, company_id, created_by)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id`,
+		req.URL, secret, pq.Array(req.EventTypes), req.Description, active, organizationID, req.CompanyID, currentUserID(c),
+	).Scan(&id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// The secret is only returned once, when the subscription is created
+	c.JSON(http.StatusCreated, gin.H{"id": id, "secret": secret, "message": "Webhook created successfully"})
+}
+
+func updateWebhook(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+	var req WebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateWebhookRequest(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !requireWebhookCompany(c, req.CompanyID) {
+		return
+	}
+
+	active := req.Active == nil || *req.Active
+	result, err := db.Exec(
+		"UPDATE webhook_subscriptions SET url = $1, event_types = $2, description = $3, active = $4, company_id = $5 WHERE id = $6",
+		req.URL, pq.Array(req.EventTypes), req.Description, active, req.CompanyID, id,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook updated successfully"})
+}
+
+func deleteWebhook(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+	if _, err := db.Exec("DELETE FROM webhook_subscriptions WHERE id = $1", id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook deleted successfully"})
+}
+
+func getWebhookDeliveries(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+	limit := 50
+	if l, err := strconv.Atoi(c.Query("limit")); err == nil && l > 0 && l <= 200 {
+		limit = l
+	}
+
+	rows, err := db.Query(`
+		SELECT id, subscription_id, event_type, payload, status, attempts, next_attempt_at, response_status, last_error, created_at, delivered_at
+		FROM webhook_deliveries
+		WHERE subscription_id = $1 AND ($2 = '' OR status = $2)
+		ORDER BY created_at DESC, id DESC
+		LIMIT $3
+	`, id, c.Query("status"), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	deliveries := []WebhookDelivery{}
+	for rows.Next() {
+		var d WebhookDelivery
+		var payload []byte
+		err := rows.Scan(&d.ID, &d.SubscriptionID, &d.EventType, &payload, &d.Status, &d.Attempts, &d.NextAttemptAt,
+			&d.ResponseStatus, &d.LastError, &d.CreatedAt, &d.DeliveredAt)
+		if err != nil {
+			continue
+		}
+		d.Payload = payload
+		deliveries = append(deliveries, d)
+	}
+
+	c.JSON(http.StatusOK, deliveries)
+}
+
+func getWebhookDeliveryAttempts(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+
+	rows, err := db.Query(`
+		SELECT id, delivery_id, attempted_at, response_status, response_body, error, duration_ms
+		FROM webhook_delivery_attempts WHERE delivery_id = $1 ORDER BY attempted_at
+	`, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	attempts := []WebhookDeliveryAttempt{}
+	for rows.Next() {
+		var a WebhookDeliveryAttempt
+		if err := rows.Scan(&a.ID, &a.DeliveryID, &a.AttemptedAt, &a.ResponseStatus, &a.ResponseBody, &a.Error, &a.DurationMs); err != nil {
+			continue
+		}
+		attempts = append(attempts, a)
+	}
+
+	c.JSON(http.StatusOK, attempts)
+}
+
+// redeliverWebhook queues a new delivery with the original payload, keeping the log
+// of the earlier one intact.
+func redeliverWebhook(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+
+	var newID int
+	err := db.QueryRow(`
+		INSERT INTO webhook_deliveries (subscription_id, event_type, payload)
+		SELECT subscription_id, event_type, payload FROM webhook_deliveries WHERE id = $1
+		RETURNING id
+	`, id).Scan(&newID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Delivery not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"id": newID, "message": "Delivery queued"})
+}
+
+type pendingWebhookDelivery struct {
+	ID          int
+	EventType   string
+	Payload     []byte
+	Attempts    int
+	MaxAttempts int
+	URL         string
+	Secret      string
+}
+
+// startWebhookWorker delivers pending webhook deliveries in the background.
+func startWebhookWorker(interval time.Duration) {
+	go func() {
+		for {
+			delivered, err := processWebhookDeliveries(10)
+			if err != nil {
+				log.Printf("Error processing webhook deliveries: %v", err)
+			}
+			if delivered == 0 || err != nil {
+				time.Sleep(interval)
+			}
+		}
+	}()
+}
+
+// webhookLease is how long a claimed delivery is hidden from other workers; it
+// covers a batch of requests at webhookClient's timeout.
+const webhookLease = 5 * time.Minute
+
+// processWebhookDeliveries sends a batch of due deliveries. The batch is claimed by
+// pushing next_attempt_at past the lease, so several instances can run the worker
+// concurrently and no transaction stays open while receivers respond.
+func processWebhookDeliveries(batch int) (int, error) {
+	rows, err := db.Query(`
+		UPDATE webhook_deliveries d SET next_attempt_at = CURRENT_TIMESTAMP + $2 * INTERVAL '1 second'
+		FROM webhook_subscriptions s
+		WHERE s.id = d.subscription_id AND d.id IN (
+			SELECT d.id FROM webhook_deliveries d
+			JOIN webhook_subscriptions s ON s.id = d.subscription_id
+			WHERE d.status = 'pending' AND d.next_attempt_at <= CURRENT_TIMESTAMP AND s.active
+			ORDER BY d.next_attempt_at
+			LIMIT $1
+			FOR UPDATE OF d SKIP LOCKED
+		)
+		RETURNING d.id, d.event_type, d.payload, d.attempts, d.max_attempts, s.url, s.secret
+	`, batch, int(webhookLease.Seconds()))
+	if err != nil {
+		return 0, err
+	}
+
+	var deliveries []pendingWebhookDelivery
+	for rows.Next() {
+		var d pendingWebhookDelivery
+		if err := rows.Scan(&d.ID, &d.EventType, &d.Payload, &d.Attempts, &d.MaxAttempts, &d.URL, &d.Secret); err != nil {
+			continue
+		}
+		deliveries = append(deliveries, d)
+	}
+	rows.Close()
+
+	for _, d := range deliveries {
+		if err := attemptWebhookDelivery(d); err != nil {
+			log.Printf("Error recording webhook delivery %d: %v", d.ID, err)
+		}
+	}
+
+	return len(deliveries), nil
+}
+
+// attemptWebhookDelivery sends the delivery and records the attempt and its outcome
+// in one short transaction.
+func attemptWebhookDelivery(d pendingWebhookDelivery) error {
+	start := time.Now()
+	status, body, sendErr := sendWebhook(d)
+	duration := time.Since(start)
+
+	var responseStatus *int
+	if status != 0 {
+		responseStatus = &status
+	}
+	var errText *string
+	if sendErr != nil {
+		text := sendErr.Error()
+		errText = &text
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO webhook_delivery_attempts (delivery_id, response_status, response_body, error, duration_ms)
+		VALUES ($1, $2, $3, $4, $5)
+	`, d.ID, responseStatus, body, errText, duration.Milliseconds())
+	if err != nil {
+		return err
+	}
+
+	attempts := d.Attempts + 1
+	switch {
+	case sendErr == nil:
+		_, err = tx.Exec(`
+			UPDATE webhook_deliveries
+			SET status = 'delivered', attempts = $1, response_status = $2, last_error = NULL, delivered_at = CURRENT_TIMESTAMP
+			WHERE id = $3
+		`, attempts, responseStatus, d.ID)
+	case attempts >= d.MaxAttempts:
+		_, err = tx.Exec(
+			"UPDATE webhook_deliveries SET status = 'failed', attempts = $1, response_status = $2, last_error = $3 WHERE id = $4",
+			attempts, responseStatus, errText, d.ID,
+		)
+	default:
+		_, err = tx.Exec(`
+			UPDATE webhook_deliveries
+			SET attempts = $1, response_status = $2, last_error = $3, next_attempt_at = CURRENT_TIMESTAMP + $4 * INTERVAL '1 second'
+			WHERE id = $5
+		`, attempts, responseStatus, errText, int(webhookBackoff(attempts).Seconds()), d.ID)
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// sendWebhook posts the signed payload. Any non-2xx response counts as a failure.
+func sendWebhook(d pendingWebhookDelivery) (int, string, error) {
+	req, err := http.NewRequest(http.MethodPost, d.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		return 0, "", err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "LMS-Webhooks/1.0")
+	req.Header.Set("X-LMS-Event", d.EventType)
+	req.Header.Set("X-LMS-Delivery", strconv.Itoa(d.ID))
+	req.Header.Set("X-LMS-Timestamp", timestamp)
+	req.Header.Set("X-LMS-Signature", "sha256="+signWebhook(d.Secret, timestamp, d.Payload))
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+
+	raw, _ := io.ReadAll(io.LimitReader(resp.Body, maxWebhookResponseBody))
+	body := strings.ReplaceAll(strings.ToValidUTF8(string(raw), ""), "\x00", "")
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, body, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, body, nil
+}
+
+// webhookBackoff gives slow or failing receivers time to recover: 30s, 1m, 2m and
+// so on, at most six hours between attempts.
+func webhookBackoff(attempts int) time.Duration {
+	delay := 30 * time.Second << uint(attempts-1)
+	if delay <= 0 || delay > 6*time.Hour {
+		delay = 6 * time.Hour
+	}
+	return delay
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// XLSXWriter produces a single-sheet Office Open XML workbook. Rows are written to
+// the compressed sheet as they come, so large sheets are not held in memory.
+type XLSXWriter struct {
+	zw    *zip.Writer
+	sheet io.Writer
+	rows  int
+	err   error
+}
+
+// XLSXCell is a cell value. Numbers are stored as numeric cells, everything else as
+// inline strings.
+type XLSXCell struct {
+	Value  string
+	Number bool
+}
+
+var xlsxParts = []struct{ name, body string }{
+	{"[Content_Types].xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>
+<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>
+<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>
+</Types>`},
+	{"_rels/.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>
+</Relationships>`},
+	{"xl/_rels/workbook.xml.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>
+<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>
+</Relationships>`},
+	// Style 1 is the bold header style
+	{"xl/styles.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>
+<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>
+<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>
+<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>
+<cellXfs count="2"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/><xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/></cellXfs>
+</styleSheet>`},
+}
+
+func NewXLSXWriter(w io.Writer, sheetName string) *XLSXWriter {
+	x := &XLSXWriter{zw: zip.NewWriter(w)}
+	for _, part := range xlsxParts {
+		x.part(part.name, part.body)
+	}
+	x.part("xl/workbook.xml", fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets><sheet name="%s" sheetId="1" r:id="rId1"/></sheets>
+</workbook>`, xlsxEscape(xlsxSheetName(sheetName))))
+
+	if x.err == nil {
+		x.sheet, x.err = x.zw.Create("xl/worksheets/sheet1.xml")
+	}
+	x.write(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	return x
+}
+
+func (x *XLSXWriter) part(name, body string) {
+	if x.err != nil {
+		return
+	}
+	f, err := x.zw.Create(name)
+	if err == nil {
+		_, err = io.WriteString(f, body)
+	}
+	x.err = err
+}
+
+func (x *XLSXWriter) write(s string) {
+	if x.err != nil {
+		return
+	}
+	_, x.err = io.WriteString(x.sheet, s)
+}
+
+// WriteRow appends a row. Header rows are bold.
+func (x *XLSXWriter) WriteRow(cells []XLSXCell, header bool) error {
+	x.rows++
+	var b strings.Builder
+	fmt.Fprintf(&b, `<row r="%d">`, x.rows)
+	style := ""
+	if header {
+		style = ` s="1"`
+	}
+	for _, cell := range cells {
+		if cell.Number && cell.Value != "" {
+			fmt.Fprintf(&b, `<c%s><v>%s</v></c>`, style, xlsxEscape(cell.Value))
+		} else {
+			fmt.Fprintf(&b, `<c t="inlineStr"%s><is><t xml:space="preserve">%s</t></is></c>`, style, xlsxEscape(cell.Value))
+		}
+	}
+	b.WriteString("</row>")
+	x.write(b.String())
+	return x.err
+}
+
+// Close ends the sheet and writes the zip directory.
+func (x *XLSXWriter) Close() error {
+	x.write("</sheetData></worksheet>")
+	if err := x.zw.Close(); x.err == nil {
+		x.err = err
+	}
+	return x.err
+}
+
+func xlsxEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// xlsxSheetName removes the characters Excel does not allow in sheet names and
+// shortens the name to 31 characters.
+func xlsxSheetName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, r) {
+			return -1
+		}
+		return r
+	}, name)
+	if runes := []rune(name); len(runes) > 31 {
+		name = string(runes[:31])
+	}
+	if name == "" {
+		name = "Sheet1"
+	}
+	return name
+}